@@ -1,10 +1,13 @@
 package cameradar
 
 import (
+	"bytes"
+	"context"
+	"crypto/x509"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
-
-	curl "github.com/Ullaakut/go-curl"
 )
 
 // HTTP responses.
@@ -13,47 +16,119 @@ const (
 	httpUnauthorized = 401
 	httpForbidden    = 403
 	httpNotFound     = 404
+
+	httpUnsupportedTransport = 461
 )
 
 // CURL RTSP request types.
 const (
+	rtspOptions  = 1
 	rtspDescribe = 2
 	rtspSetup    = 4
+	rtspPlay     = 5
+	rtspTeardown = 7
+	rtspReceive  = 11
 )
 
 // Attack attacks the given targets and returns the accessed streams.
 func (s *Scanner) Attack(targets []Stream) ([]Stream, error) {
+	return s.AttackContext(context.Background(), targets)
+}
+
+// AttackContext attacks the given targets and returns the accessed streams. If the
+// context is done before the attack is over, in-flight requests are aborted and the
+// streams as they were when the attack was interrupted are returned along with the
+// context's error.
+func (s *Scanner) AttackContext(ctx context.Context, targets []Stream) ([]Stream, error) {
 	if len(targets) == 0 {
 		return nil, fmt.Errorf("unable to attack empty list of targets")
 	}
 
+	s.term.StartStepf("Fingerprinting %d streams", len(targets))
+	streams := s.FingerprintStreamsContext(ctx, targets)
+	if ctx.Err() != nil {
+		return streams, s.term.FailStep(ctx.Err())
+	}
+
+	if s.onvif {
+		s.term.StartStepf("Retrieving stream URIs of %d streams through ONVIF", len(targets))
+		streams = s.RetrieveONVIFRoutesContext(ctx, streams)
+		if ctx.Err() != nil {
+			return streams, s.term.FailStep(ctx.Err())
+		}
+	}
+
 	// Most cameras will be accessed successfully with these two attacks.
 	s.term.StartStepf("Attacking routes of %d streams", len(targets))
-	streams := s.AttackRoute(targets)
+	streams = s.AttackRouteContext(ctx, streams)
+	if ctx.Err() != nil {
+		return streams, s.term.FailStep(ctx.Err())
+	}
+
+	s.term.StartStepf("Enumerating channels of %d streams", len(targets))
+	streams = s.EnumerateChannelsContext(ctx, streams)
+	if ctx.Err() != nil {
+		return streams, s.term.FailStep(ctx.Err())
+	}
 
 	s.term.StartStepf("Attempting to detect authentication methods of %d streams", len(targets))
-	streams = s.DetectAuthMethods(streams)
+	streams = s.DetectAuthMethodsContext(ctx, streams)
+	if ctx.Err() != nil {
+		return streams, s.term.FailStep(ctx.Err())
+	}
 
 	s.term.StartStepf("Attacking credentials of %d streams", len(targets))
-	streams = s.AttackCredentials(streams)
+	streams = s.AttackCredentialsContext(ctx, streams)
+	if ctx.Err() != nil {
+		return streams, s.term.FailStep(ctx.Err())
+	}
 
-	s.term.StartStep("Validating that streams are accessible")
-	streams = s.ValidateStreams(streams)
+	// Streams that require authentication before telling whether a route exists,
+	// like the ones running GST RTSP Server, can only have their routes attacked
+	// once their credentials are known.
+	var pending []int
+	for i, stream := range streams {
+		if stream.RouteBehavior == RouteBehaviorAuthFirst && len(stream.ValidRoutes) == 0 && stream.CredentialsFound {
+			pending = append(pending, i)
+		}
+	}
 
-	// But some cameras run GST RTSP Server which prioritizes 401 over 404 contrary to most cameras.
-	// For these cameras, running another route attack will solve the problem.
-	for _, stream := range streams {
-		if len(stream.ValidRoutes) == 0 	{
-			s.term.StartStepf("Second round of attacks")
-			streams = s.AttackRoute(streams)
+	if len(pending) > 0 {
+		authFirst := make([]Stream, 0, len(pending))
+		for _, i := range pending {
+			authFirst = append(authFirst, streams[i])
+		}
 
-			s.term.StartStep("Validating that streams are accessible")
-			streams = s.ValidateStreams(streams)
+		s.term.StartStepf("Attacking routes of %d authenticated streams", len(authFirst))
+		authFirst = s.FingerprintStreamsContext(ctx, authFirst)
+		authFirst = s.AttackRouteContext(ctx, authFirst)
+		authFirst = s.EnumerateChannelsContext(ctx, authFirst)
+		authFirst = s.DetectAuthMethodsContext(ctx, authFirst)
+		authFirst = s.AttackCredentialsContext(ctx, authFirst)
 
-			break
+		for j, i := range pending {
+			streams[i] = authFirst[j]
+		}
+
+		if ctx.Err() != nil {
+			return streams, s.term.FailStep(ctx.Err())
 		}
 	}
 
+	if s.onvifInventory {
+		s.term.StartStepf("Retrieving ONVIF device information of %d streams", len(targets))
+		streams = s.InventoryONVIFDevicesContext(ctx, streams)
+		if ctx.Err() != nil {
+			return streams, s.term.FailStep(ctx.Err())
+		}
+	}
+
+	s.term.StartStep("Validating that streams are accessible")
+	streams = s.ValidateStreamsContext(ctx, streams)
+	if ctx.Err() != nil {
+		return streams, s.term.FailStep(ctx.Err())
+	}
+
 	s.term.EndStep()
 
 	return streams, nil
@@ -61,321 +136,637 @@ func (s *Scanner) Attack(targets []Stream) ([]Stream, error) {
 
 // ValidateStreams tries to setup the stream to validate whether or not it is available.
 func (s *Scanner) ValidateStreams(targets []Stream) []Stream {
-	for i, target := range targets {
-		for c, route := range target.ValidRoutes	{
-			targets[i].ValidRoutes[c].Available = s.validateStream(targets[i], route.Route)
-			time.Sleep(s.attackInterval)
-		}
-	}
+	return s.ValidateStreamsContext(context.Background(), targets)
+}
 
-	return targets
+// ValidateStreamsContext is like ValidateStreams, but stops validating streams
+// once the given context is done.
+func (s *Scanner) ValidateStreamsContext(ctx context.Context, targets []Stream) []Stream {
+	return s.attackStreams(targets, func(target Stream) Stream {
+		return s.validateCameraStreams(ctx, target)
+	})
 }
 
 // AttackCredentials attempts to guess the provided targets' credentials using the given
-// dictionary or the default dictionary if none was provided by the user.
+// dictionary or the default dictionary if none was provided by the user. The credentials
+// given using WithUsername and WithPassword are always tried first.
 func (s *Scanner) AttackCredentials(targets []Stream) []Stream {
-	resChan := make(chan Stream)
-	defer close(resChan)
-
-	for _, target := range targets {
-		// TODO: Perf Improvement: Skip cameras with no auth type detected, and set their
-		// CredentialsFound value to true.
-		go s.attackCameraCredentials(target, resChan)
-	}
-
-	attackResults := []Stream{}
-	// TODO: Change this into a for+select and make a successful result close the chan.
-	for range targets {
-		attackResults = append(attackResults, <-resChan)
-	}
+	return s.AttackCredentialsContext(context.Background(), targets)
+}
 
-	return attackResults
+// AttackCredentialsContext is like AttackCredentials, but stops attacking
+// credentials once the given context is done.
+func (s *Scanner) AttackCredentialsContext(ctx context.Context, targets []Stream) []Stream {
+	// TODO: Perf Improvement: Skip cameras with no auth type detected, and set their
+	// CredentialsFound value to true.
+	return s.attackStreams(targets, func(target Stream) Stream {
+		return s.attackCameraCredentials(ctx, target)
+	})
 }
 
 // AttackRoute attempts to guess the provided targets' streaming routes using the given
 // dictionary or the default dictionary if none was provided by the user.
 func (s *Scanner) AttackRoute(targets []Stream) []Stream {
-	resChan := make(chan Stream)
-	defer close(resChan)
+	return s.AttackRouteContext(context.Background(), targets)
+}
 
-	for i := range targets {
-		go s.attackCameraRoute(targets[i], resChan)
-	}
+// AttackRouteContext is like AttackRoute, but stops attacking routes once
+// the given context is done.
+func (s *Scanner) AttackRouteContext(ctx context.Context, targets []Stream) []Stream {
+	return s.attackStreams(targets, func(target Stream) Stream {
+		return s.attackCameraRoute(ctx, target)
+	})
+}
+
+// DetectAuthMethods attempts to guess the provided targets' authentication types, between
+// digest, basic auth or none at all.
+func (s *Scanner) DetectAuthMethods(targets []Stream) []Stream {
+	return s.DetectAuthMethodsContext(context.Background(), targets)
+}
+
+// DetectAuthMethodsContext is like DetectAuthMethods, but stops detecting
+// authentication methods once the given context is done.
+func (s *Scanner) DetectAuthMethodsContext(ctx context.Context, targets []Stream) []Stream {
+	return s.attackStreams(targets, func(target Stream) Stream {
+		return s.detectCameraAuthMethod(ctx, target)
+	})
+}
+
+func (s *Scanner) detectCameraAuthMethod(ctx context.Context, target Stream) Stream {
+	// Streams whose routes are unknown have their authentication method detected
+	// on their root route.
+	if len(target.ValidRoutes) == 0 {
+		s.attemptAll(ctx, target, 1, func(int) bool {
+			target.AuthenticationType, target.AuthenticationSchemes, target.Certificate = s.detectAuthMethod(ctx, target, "")
+			return true
+		})
 
-	attackResults := []Stream{}
-	// TODO: Change this into a for+select and make a successful result close the chan.
-	for range targets {
-		attackResults = append(attackResults, <-resChan)
+		s.term.Debugf("Stream %s uses %s authentication method\n", GetCameraRTSPURL(target), authMethodName(target.AuthenticationType))
+
+		return target
 	}
 
-	for i := range attackResults {
-		if len(attackResults[i].ValidRoutes) > 0 {
-			targets = replace(targets, attackResults[i])
+	// Routes of a same stream can require different authentication methods, like
+	// the main stream and sub-streams of some encoders.
+	certificates := make([]*Certificate, len(target.ValidRoutes))
+	s.attemptAll(ctx, target, len(target.ValidRoutes), func(i int) bool {
+		route := &target.ValidRoutes[i]
+		route.AuthenticationType, route.AuthenticationSchemes, certificates[i] = s.detectAuthMethod(ctx, target, route.Route)
+		return false
+	})
+
+	target.AuthenticationType = target.ValidRoutes[0].AuthenticationType
+	target.AuthenticationSchemes = target.ValidRoutes[0].AuthenticationSchemes
+	for _, certificate := range certificates {
+		if certificate != nil {
+			target.Certificate = certificate
+			break
 		}
 	}
-	return targets
+
+	for _, route := range target.ValidRoutes {
+		s.term.Debugf("Route %s uses %s authentication method\n", GetRouteRTSPURL(target, route), authMethodName(route.AuthenticationType))
+	}
+
+	return target
 }
 
-// DetectAuthMethods attempts to guess the provided targets' authentication types, between
-// digest, basic auth or none at all.
-func (s *Scanner) DetectAuthMethods(targets []Stream) []Stream {
-	for i := range targets {
-		targets[i].AuthenticationType = s.detectAuthMethod(targets[i])
-		time.Sleep(s.attackInterval)
-
-		var authMethod string
-		switch targets[i].AuthenticationType {
-		case 0:
-			authMethod = "no"
-		case 1:
-			authMethod = "basic"
-		case 2:
-			authMethod = "digest"
+func (s *Scanner) validateCameraStreams(ctx context.Context, target Stream) Stream {
+	// Each route is accessed with its own credentials and authentication method.
+	s.attemptAll(ctx, target, len(target.ValidRoutes), func(i int) bool {
+		route := &target.ValidRoutes[i]
+		route.Transport, route.Available = s.validateStream(ctx, routeStream(target, *route), route.Route)
+		return false
+	})
+
+	// Describe the available routes to learn about their media tracks.
+	s.attemptAll(ctx, target, len(target.ValidRoutes), func(i int) bool {
+		route := &target.ValidRoutes[i]
+		if !route.Available {
+			return false
 		}
 
-		s.term.Debugf("Stream %s uses %s authentication method\n", GetCameraRTSPURL(targets[i]), authMethod)
+		sdp, ok := s.describeStream(ctx, routeStream(target, *route), route.Route)
+		if ok {
+			route.Tracks = parseSDP(sdp)
+		}
+		return false
+	})
+
+	// Routes which can be set up might still never send any media.
+	if s.playbackValidation {
+		s.attemptAll(ctx, target, len(target.ValidRoutes), func(i int) bool {
+			route := &target.ValidRoutes[i]
+			if !route.Available {
+				return false
+			}
+
+			var transport string
+			route.PacketsReceived, route.FirstPacketLatency, transport = s.playStream(ctx, routeStream(target, *route), *route)
+			route.Available = route.PacketsReceived > 0
+			if route.Available {
+				// Report the transport with which the media was actually received.
+				route.Transport = transport
+			}
+			return false
+		})
 	}
 
-	return targets
+	return classifyStreams(target)
 }
 
-func (s *Scanner) attackCameraCredentials(target Stream, resChan chan<- Stream) {
-	for i, route := range target.ValidRoutes{
-		ok := s.credAttack(target, s.username, s.password, route.Route)
+func (s *Scanner) attackCameraCredentials(ctx context.Context, target Stream) Stream {
+	// Streams that require authentication on every route have their credentials
+	// attacked on a route that does not exist, which is answered by a 404 once
+	// the credentials are valid.
+	if target.RouteBehavior == RouteBehaviorAuthFirst && len(target.ValidRoutes) == 0 {
+		pair, ok := s.findCredentials(ctx, target, target.AuthenticationType, canaryRoute())
+		target.CredentialsFound = ok
+		if ok {
+			target.Username = pair.username
+			target.Password = pair.password
+		}
+
+		return target
+	}
+
+	// Credentials are attacked on each route independently, since the routes of a
+	// same stream can be accessed with different accounts.
+	for i, route := range target.ValidRoutes {
+		pair, ok := s.findCredentials(ctx, target, route.AuthenticationType, route.Route)
+		route.CredentialsFound = ok
 		if ok {
-			route.CredentialsFound = true
-			target.Username = s.username
-			target.Password = s.password
-		} else {
-			route.CredentialsFound = false
+			route.Username = pair.username
+			route.Password = pair.password
 		}
+
 		target.ValidRoutes[i] = route
-		time.Sleep(s.attackInterval)
 	}
-	resChan <- target
+
+	// The credentials of the stream are the ones of its first accessible route.
+	for _, route := range target.ValidRoutes {
+		if route.CredentialsFound {
+			target.CredentialsFound = true
+			target.Username = route.Username
+			target.Password = route.Password
+			break
+		}
+	}
+
+	return target
 }
 
-func (s *Scanner) attackCameraRoute(target Stream, resChan chan<- Stream) {
-	var v ValidRoute
+// findCredentials returns the first credentials that give access to the given
+// route of the stream using the given authentication method, if any.
+func (s *Scanner) findCredentials(ctx context.Context, target Stream, authType int, route string) (credentialPair, bool) {
+	// Try the credentials that were already found for this stream first.
+	var candidates []credentialPair
+	seen := make(map[credentialPair]bool)
+	add := func(pair credentialPair) {
+		if seen[pair] {
+			return
+		}
+		seen[pair] = true
+		candidates = append(candidates, pair)
+	}
 
-	for _, route := range s.routes {
-		ok := s.routeAttack(target, route)
-		if ok {
-			// Route=route, credentials_found=false, available=false
-			v.Route = route
-			v.CredentialsFound = false
-			v.Available = false
+	if target.CredentialsFound || target.Username != "" || target.Password != "" {
+		add(credentialPair{target.Username, target.Password})
+	}
+	for _, validRoute := range target.ValidRoutes {
+		if validRoute.CredentialsFound {
+			add(credentialPair{validRoute.Username, validRoute.Password})
+		}
+	}
+	for _, pair := range s.credentialPairs() {
+		add(pair)
+	}
+
+	target.AuthenticationType = authType
 
-			target.ValidRoutes = append(target.ValidRoutes, v)
+	// Several candidates can be accepted when they are tried concurrently,
+	// in which case the first one in the dictionary order is kept.
+	found := make([]bool, len(candidates))
+	s.attemptAll(ctx, target, len(candidates), func(c int) bool {
+		found[c] = s.credAttack(ctx, target, candidates[c].username, candidates[c].password, route)
+		return found[c]
+	})
+
+	for c, ok := range found {
+		if ok {
+			return candidates[c], true
 		}
-		time.Sleep(s.attackInterval)
 	}
 
-	resChan <- target
+	return credentialPair{}, false
 }
 
-func (s *Scanner) detectAuthMethod(stream Stream) int {
-	c := s.curl.Duphandle()
+// credentialPair is a username and password combination.
+type credentialPair struct {
+	username string
+	password string
+}
 
-	// Will only scan the first valid route of the device
-	route := ""
-	if len(stream.ValidRoutes) > 0{
-		route = stream.ValidRoutes[0].Route
+// credentialPairs returns the credentials to try on each stream, in order: the
+// ones given by the user, the explicit pairs of the credentials dictionary and
+// then every username of the dictionary with every password.
+func (s *Scanner) credentialPairs() []credentialPair {
+	var pairs []credentialPair
+	seen := make(map[credentialPair]bool)
+	add := func(pair credentialPair) {
+		if seen[pair] {
+			return
+		}
+		seen[pair] = true
+		pairs = append(pairs, pair)
 	}
 
-	attackURL := fmt.Sprintf(
-		"rtsp://%s:%d/%s",
-		stream.Address,
-		stream.Port,
-		route, 
-	)
+	add(credentialPair{s.username, s.password})
 
-	s.setCurlOptions(c)
+	for _, pair := range s.credentials.Pairs {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			s.term.Debugf("Ignoring invalid credentials pair %q\n", pair)
+			continue
+		}
+		add(credentialPair{parts[0], parts[1]})
+	}
 
-	// Send a request to the URL of the stream we want to attack.
-	_ = c.Setopt(curl.OPT_URL, attackURL)
-	// Set the RTSP STREAM URI as the stream URL.
-	_ = c.Setopt(curl.OPT_RTSP_STREAM_URI, attackURL)
-	_ = c.Setopt(curl.OPT_RTSP_REQUEST, rtspDescribe)
+	for _, username := range s.credentials.Usernames {
+		for _, password := range s.credentials.Passwords {
+			add(credentialPair{username, password})
+		}
+	}
 
-	// Perform the request.
-	err := c.Perform()
-	if err != nil {
-		s.term.Errorf("Perform failed for %q (auth %d): %v", attackURL, stream.AuthenticationType, err)
-		return -1
+	return pairs
+}
+
+func (s *Scanner) attackCameraRoute(ctx context.Context, target Stream) Stream {
+	// Routes retrieved through ONVIF are the exact routes of the camera.
+	if hasONVIFRoutes(target) {
+		return target
 	}
 
-	authType, err := c.Getinfo(curl.INFO_HTTPAUTH_AVAIL)
-	if err != nil {
-		s.term.Errorf("Getinfo failed: %v", err)
-		return -1
+	switch target.RouteBehavior {
+	case RouteBehaviorAcceptAll:
+		// Any route gives access to the stream, so the dictionary would be found
+		// entirely. Only the root route is kept.
+		if len(target.ValidRoutes) == 0 {
+			target.ValidRoutes = append(target.ValidRoutes, ValidRoute{})
+		}
+		return target
+	case RouteBehaviorAuthFirst:
+		// Every route is answered with a 401 until credentials are found.
+		return target
 	}
 
-	if s.verbose {
-		s.term.Debugln("DESCRIBE", attackURL, "RTSP/1.0 >", authType)
+	routes := s.expandRoutes(target, s.routesFor(target))
+
+	found := make([]bool, len(routes))
+	s.attemptAll(ctx, target, len(routes), func(i int) bool {
+		found[i] = s.routeAttack(ctx, target, routes[i])
+		return false
+	})
+
+	for i, route := range routes {
+		if found[i] {
+			// Route=route, credentials_found=false, available=false
+			target.ValidRoutes = append(target.ValidRoutes, ValidRoute{Route: route})
+		}
 	}
 
-	return authType.(int)
+	return target
 }
 
-func (s *Scanner) routeAttack(stream Stream, route string) bool {
-	c := s.curl.Duphandle()
+// vendorRoutes are the routes of a vendor from a structured route dictionary.
+type vendorRoutes struct {
+	vendor   string
+	products []*regexp.Regexp
+	routes   Routes
+}
 
-	attackURL := fmt.Sprintf(
-		"rtsp://%s:%s@%s:%d/%s",
-		stream.Username,
-		stream.Password,
-		stream.Address,
-		stream.Port,
-		route,
-	)
+// matches returns whether the given stream was made by the vendor, based on its
+// device model or on its hardware vendor.
+func (v vendorRoutes) matches(target Stream) bool {
+	if target.HardwareVendor != "" && strings.Contains(strings.ToLower(target.HardwareVendor), strings.ToLower(v.vendor)) {
+		return true
+	}
 
-	s.setCurlOptions(c)
+	if target.Device == "" {
+		return false
+	}
 
-	// Set proper authentication type.
-	_ = c.Setopt(curl.OPT_HTTPAUTH, stream.AuthenticationType)
-	_ = c.Setopt(curl.OPT_USERPWD, fmt.Sprint(stream.Username, ":", stream.Password))
+	for _, product := range v.products {
+		if product.MatchString(target.Device) {
+			return true
+		}
+	}
+	return false
+}
 
-	// Send a request to the URL of the stream we want to attack.
-	_ = c.Setopt(curl.OPT_URL, attackURL)
-	// Set the RTSP STREAM URI as the stream URL.
-	_ = c.Setopt(curl.OPT_RTSP_STREAM_URI, attackURL)
-	_ = c.Setopt(curl.OPT_RTSP_REQUEST, rtspDescribe)
+// routesFor returns the routes to attack on the given stream. Routes of the vendors
+// whose products match the stream's device model, or who made its hardware, are
+// attacked first, followed by the generic routes.
+func (s *Scanner) routesFor(target Stream) Routes {
+	if len(s.vendorRoutes) == 0 || (target.Device == "" && target.HardwareVendor == "") {
+		return s.routes
+	}
+
+	var routes Routes
+	seen := make(map[string]bool)
+	add := func(route string) {
+		if seen[route] {
+			return
+		}
+		seen[route] = true
+		routes = append(routes, route)
+	}
+
+	for _, vendor := range s.vendorRoutes {
+		if !vendor.matches(target) {
+			continue
+		}
+
+		s.term.Debugf("Stream %s matches vendor %q\n", GetCameraRTSPURL(target), vendor.vendor)
+		for _, route := range vendor.routes {
+			add(route)
+		}
+	}
+
+	for _, route := range s.routes {
+		add(route)
+	}
+
+	return routes
+}
+
+// detectAuthMethod returns the strongest authentication method offered on the given
+// route of the stream along with all the schemes it offers and, for RTSPS streams,
+// the certificate it presented. The method is authUnknown if it could not be detected.
+func (s *Scanner) detectAuthMethod(ctx context.Context, stream Stream, route string) (int, []AuthenticationScheme, *Certificate) {
+	c, attackURL := s.newRequest(ctx, stream, route, "", "", rtspDescribe)
+
+	// Capture the response headers to parse their authentication challenges.
+	var headers bytes.Buffer
+	_ = c.Setopt(optHeaderFunction, func(data []byte, _ interface{}) bool {
+		headers.Write(data)
+		return true
+	})
+
+	_, err := s.perform(ctx, c, "DESCRIBE", attackURL, stream.AuthenticationType)
+
+	// The certificate is captured even if it could not be verified.
+	var certificate *Certificate
+	if stream.TLS {
+		certificate = peerCertificate(c)
+	}
 
-	// Perform the request.
-	err := c.Perform()
 	if err != nil {
-		s.term.Errorf("Perform failed for %q (auth %d): %v", attackURL, stream.AuthenticationType, err)
-		return false
+		return authUnknown, nil, certificate
 	}
 
-	// Get return code for the request.
-	rc, err := c.Getinfo(curl.INFO_RESPONSE_CODE)
+	available, err := c.Getinfo(infoHTTPAuthAvail)
 	if err != nil {
 		s.term.Errorf("Getinfo failed: %v", err)
-		return false
+		return authUnknown, nil, certificate
 	}
 
-	if s.verbose {
-		s.term.Debugln("DESCRIBE", attackURL, "RTSP/1.0 >", rc)
+	bitmask, ok := available.(int)
+	if !ok {
+		s.term.Errorf("Getinfo returned invalid authentication methods %v", available)
+		return authUnknown, nil, certificate
 	}
-	// If it's a 401 or 403, it means that the credentials are wrong but the route might be okay.
-	// If it's a 200, the stream is accessed successfully.
-	if rc == httpOK || rc == httpUnauthorized || rc == httpForbidden {
-		return true
+
+	schemes := parseAuthenticationSchemes(headers.String())
+
+	if s.verbose {
+		s.term.Debugln("DESCRIBE", attackURL, "RTSP/1.0 >", bitmask, schemes)
 	}
-	return false
+
+	return strongestAuth(bitmask, schemes), schemes, certificate
 }
 
-func (s *Scanner) credAttack(stream Stream, username string, password string, route string) bool {
-	c := s.curl.Duphandle()
+// peerCertificate returns the certificate presented by the server on the last
+// request of the given handle, if any.
+func peerCertificate(c Curler) *Certificate {
+	info, err := c.Getinfo(infoCertInfo)
+	if err != nil {
+		return nil
+	}
 
-	attackURL := fmt.Sprintf(
-		"rtsp://%s:%s@%s:%d/%s",
-		username,
-		password,
-		stream.Address,
-		stream.Port,
-		route, 
-	)
+	chain, ok := info.([]*x509.Certificate)
+	if !ok || len(chain) == 0 {
+		return nil
+	}
 
-	s.setCurlOptions(c)
+	return &Certificate{
+		Subject:   chain[0].Subject.String(),
+		Issuer:    chain[0].Issuer.String(),
+		NotBefore: chain[0].NotBefore,
+		NotAfter:  chain[0].NotAfter,
+	}
+}
 
-	// Set proper authentication type.
-	_ = c.Setopt(curl.OPT_HTTPAUTH, stream.AuthenticationType)
-	_ = c.Setopt(curl.OPT_USERPWD, fmt.Sprint(username, ":", password))
+func (s *Scanner) routeAttack(ctx context.Context, stream Stream, route string) bool {
+	code, err := s.describe(ctx, stream, route, stream.Username, stream.Password)
+	if err != nil {
+		return false
+	}
 
-	// Send a request to the URL of the stream we want to attack.
-	_ = c.Setopt(curl.OPT_URL, attackURL)
-	// Set the RTSP STREAM URI as the stream URL.
-	_ = c.Setopt(curl.OPT_RTSP_STREAM_URI, attackURL)
-	_ = c.Setopt(curl.OPT_RTSP_REQUEST, rtspDescribe)
+	// If it's a 401 or 403, it means that the credentials are wrong but the route might be okay.
+	// If it's a 200, the stream is accessed successfully.
+	return code == httpOK || code == httpUnauthorized || code == httpForbidden
+}
 
-	// Perform the request.
-	err := c.Perform()
+func (s *Scanner) credAttack(ctx context.Context, stream Stream, username string, password string, route string) bool {
+	code, err := s.describe(ctx, stream, route, username, password)
 	if err != nil {
-		s.term.Errorf("Perform failed for %q (auth %d): %v", attackURL, stream.AuthenticationType, err)
 		return false
 	}
 
-	// Get return code for the request.
-	rc, err := c.Getinfo(curl.INFO_RESPONSE_CODE)
+	// If it's a 404, it means that the route is incorrect but the credentials might be okay.
+	// If it's a 200, the stream is accessed successfully.
+	return code == httpOK || code == httpNotFound
+}
+
+// validateStream sets up the given route of the stream using each RTP transport
+// until one is supported, and returns the transport with which it was set up.
+func (s *Scanner) validateStream(ctx context.Context, stream Stream, route string) (string, bool) {
+	for _, transport := range transports {
+		switch s.setupStream(ctx, stream, route, transport) {
+		case httpOK:
+			return transport, true
+		case httpUnsupportedTransport:
+			continue
+		default:
+			return "", false
+		}
+	}
+
+	return "", false
+}
+
+// setupStream sends a SETUP request on the given route of the stream using the given
+// RTP transport, and returns the status code of the response, or -1 if the request failed.
+func (s *Scanner) setupStream(ctx context.Context, stream Stream, route, transport string) int {
+	c, attackURL := s.newRequest(ctx, stream, route, stream.Username, stream.Password, rtspSetup)
+
+	header, _, closePorts, err := transportHeader(transport)
 	if err != nil {
-		s.term.Errorf("Getinfo failed: %v", err)
-		return false
+		s.term.Errorf("Unable to set up %s transport: %v", transport, err)
+		return -1
 	}
+	defer closePorts()
+	_ = c.Setopt(optRTSPTransport, header)
 
-	if s.verbose {
-		s.term.Debugln("DESCRIBE", attackURL, "RTSP/1.0 >", rc)
+	code, err := s.perform(ctx, c, "SETUP", attackURL, stream.AuthenticationType)
+	if err != nil {
+		return -1
 	}
 
-	// If it's a 404, it means that the route is incorrect but the credentials might be okay.
 	// If it's a 200, the stream is accessed successfully.
-	if rc == httpOK || rc == httpNotFound {
+	if code == httpOK {
+		teardown(c, attackURL)
+	}
+	return code
+}
+
+// describeStream sends a DESCRIBE request on the given route of the stream and
+// returns the session description of the stream, if the request succeeded.
+func (s *Scanner) describeStream(ctx context.Context, stream Stream, route string) (string, bool) {
+	c, attackURL := s.newRequest(ctx, stream, route, stream.Username, stream.Password, rtspDescribe)
+
+	// Capture the SDP sent in the response body.
+	var sdp bytes.Buffer
+	_ = c.Setopt(optNoBody, 0)
+	_ = c.Setopt(optWriteFunction, func(data []byte, _ interface{}) bool {
+		sdp.Write(data)
 		return true
+	})
+
+	code, err := s.perform(ctx, c, "DESCRIBE", attackURL, stream.AuthenticationType)
+	if err != nil || code != httpOK {
+		return "", false
 	}
-	return false
+
+	return sdp.String(), true
 }
 
-func (s *Scanner) validateStream(stream Stream, route string) bool {
-	c := s.curl.Duphandle()
+// describe sends a DESCRIBE request on the given route of the stream using the given
+// credentials, and returns the status code of the response, or -1 if the request failed.
+func (s *Scanner) describe(ctx context.Context, stream Stream, route, username, password string) (int, error) {
+	c, attackURL := s.newRequest(ctx, stream, route, username, password, rtspDescribe)
+	return s.perform(ctx, c, "DESCRIBE", attackURL, stream.AuthenticationType)
+}
+
+// newRequest returns a handle on which the given RTSP request is set up for the given
+// route of the stream using the given credentials, along with the URL of the route.
+func (s *Scanner) newRequest(ctx context.Context, stream Stream, route, username, password string, request int) (Curler, string) {
+	c := s.handle(stream)
 
-	attackURL := fmt.Sprintf(
-		"rtsp://%s:%s@%s:%d/%s",
-		stream.Username,
-		stream.Password,
-		stream.Address,
-		stream.Port,
-		route,
-	)
+	attackURL := streamURL(stream, username, password, route)
 
-	s.setCurlOptions(c)
+	s.setCurlOptions(ctx, c)
 
 	// Set proper authentication type.
-	_ = c.Setopt(curl.OPT_HTTPAUTH, stream.AuthenticationType)
-	_ = c.Setopt(curl.OPT_USERPWD, fmt.Sprint(stream.Username, ":", stream.Password))
+	_ = c.Setopt(optHTTPAuth, httpAuth(stream.AuthenticationType))
+	_ = c.Setopt(optUserPwd, fmt.Sprint(username, ":", password))
 
-	// Send a request to the URL of the stream we want to attack.
-	_ = c.Setopt(curl.OPT_URL, attackURL)
-	// Set the RTSP STREAM URI as the stream URL.
-	_ = c.Setopt(curl.OPT_RTSP_STREAM_URI, attackURL)
-	_ = c.Setopt(curl.OPT_RTSP_REQUEST, rtspSetup)
+	// Send the request to the URL of the route, which is also its RTSP stream URI.
+	_ = c.Setopt(optURL, attackURL)
+	_ = c.Setopt(optRTSPStreamURI, attackURL)
+	_ = c.Setopt(optRTSPRequest, request)
 
-	_ = c.Setopt(curl.OPT_RTSP_TRANSPORT, "RTP/AVP;unicast;client_port=33332-33333")
+	return c, attackURL
+}
 
-	// Perform the request.
+// perform performs the request set up on the given handle, and returns the status
+// code of its response, or -1 if the request failed.
+func (s *Scanner) perform(ctx context.Context, c Curler, method, attackURL string, authType int) (int, error) {
 	err := c.Perform()
 	if err != nil {
-		s.term.Errorf("Perform failed for %q (auth %d): %v", attackURL, stream.AuthenticationType, err)
-		return false
+		// Requests aborted because the context is done are not failures.
+		if ctx.Err() == nil {
+			s.term.Errorf("Perform failed for %q (auth %d): %v", attackURL, authType, err)
+		}
+		return -1, err
 	}
 
 	// Get return code for the request.
-	rc, err := c.Getinfo(curl.INFO_RESPONSE_CODE)
+	rc, err := c.Getinfo(infoResponseCode)
 	if err != nil {
 		s.term.Errorf("Getinfo failed: %v", err)
-		return false
+		return -1, err
+	}
+
+	code, ok := rc.(int)
+	if !ok {
+		s.term.Errorf("Getinfo returned invalid response code %v", rc)
+		return -1, fmt.Errorf("invalid response code %v", rc)
 	}
 
 	if s.verbose {
-		s.term.Debugln("SETUP", attackURL, "RTSP/1.0 >", rc)
+		s.term.Debugln(method, attackURL, "RTSP/1.0 >", code)
 	}
-	// If it's a 200, the stream is accessed successfully.
-	if rc == httpOK {
-		return true
+
+	return code, nil
+}
+
+// handle returns a new handle with which to send requests to the given stream.
+// Streams tunneled in HTTP are only supported by the native client, on which
+// tunneling is enabled.
+func (s *Scanner) handle(stream Stream) Curler {
+	switch {
+	case stream.HTTPTunnel:
+		c := s.nativeHandle().Duphandle()
+		_ = c.Setopt(optHTTPTunnel, 1)
+		return c
+	case stream.TLS:
+		return s.nativeHandle().Duphandle()
+	default:
+		return s.curl.Duphandle()
 	}
-	return false
 }
 
-func (s *Scanner) setCurlOptions(c Curler) {
+// nativeHandle returns the handle from which the handles used to attack the
+// streams that libcurl does not support are duplicated.
+func (s *Scanner) nativeHandle() Curler {
+	if s.nativeCurl != nil {
+		return s.nativeCurl
+	}
+	return s.curl
+}
+
+// rtspScheme returns the URL scheme with which to access the given stream.
+func rtspScheme(stream Stream) string {
+	if stream.TLS {
+		return "rtsps"
+	}
+	return "rtsp"
+}
+
+func (s *Scanner) setCurlOptions(ctx context.Context, c Curler) {
 	// Do not write sdp in stdout
-	_ = c.Setopt(curl.OPT_WRITEFUNCTION, doNotWrite)
+	_ = c.Setopt(optWriteFunction, doNotWrite)
 	// Do not use signals (would break multithreading).
-	_ = c.Setopt(curl.OPT_NOSIGNAL, 1)
+	_ = c.Setopt(optNoSignal, 1)
 	// Do not send a body in the describe request.
-	_ = c.Setopt(curl.OPT_NOBODY, 1)
+	_ = c.Setopt(optNoBody, 1)
 	// Set custom timeout.
-	_ = c.Setopt(curl.OPT_TIMEOUT_MS, int(s.timeout/time.Millisecond))
+	_ = c.Setopt(optTimeoutMS, int(s.timeout/time.Millisecond))
+	// Abort the request once the context is done.
+	_ = c.Setopt(optNoProgress, 0)
+	_ = c.Setopt(optProgressFunc, func(float64, float64, float64, float64, interface{}) bool {
+		return ctx.Err() == nil
+	})
+	// Verify the certificates of RTSPS streams unless told otherwise.
+	if s.tlsInsecure {
+		_ = c.Setopt(optSSLVerifyPeer, 0)
+		_ = c.Setopt(optSSLVerifyHost, 0)
+	}
+	if s.tlsCABundlePath != "" {
+		_ = c.Setopt(optCAInfo, s.tlsCABundlePath)
+	}
 }
 
 // HACK: See https://stackoverflow.com/questions/3572397/lib-curl-in-c-disable-printing
@@ -0,0 +1,109 @@
+package cameradar
+
+import (
+	"bufio"
+	"net/textproto"
+	"strings"
+)
+
+// authUnknown is the authentication method of streams whose authentication method
+// could not be detected, or which only offer schemes that cameradar does not support.
+// It is never passed to libcurl, which is then allowed to use any method.
+const authUnknown = -1
+
+// authSchemeMethods are the libcurl authentication methods of the supported schemes.
+var authSchemeMethods = map[string]int{
+	"basic":  authBasic,
+	"digest": authDigest,
+}
+
+// authMethodName returns the name of the given authentication method.
+func authMethodName(authType int) string {
+	switch authType {
+	case authNone:
+		return "no"
+	case authBasic:
+		return "basic"
+	case authDigest:
+		return "digest"
+	default:
+		return "unknown"
+	}
+}
+
+// authMethodJSON returns the name of the given authentication method as it is written
+// in the JSON output, along with the method itself unless it is unknown.
+func authMethodJSON(authType int) (string, *int) {
+	switch authType {
+	case authNone:
+		return "none", &authType
+	case authBasic, authDigest:
+		return authMethodName(authType), &authType
+	default:
+		return "unknown", nil
+	}
+}
+
+// httpAuth returns the libcurl authentication methods to allow when accessing a
+// stream using the given authentication method.
+func httpAuth(authType int) int {
+	if authType == authUnknown {
+		return authBasic | authDigest
+	}
+	return authType
+}
+
+// strongestAuth returns the strongest authentication method of the given libcurl
+// authentication bitmask and offered schemes. Digest authentication is preferred
+// since it does not send the credentials in clear text.
+func strongestAuth(available int, schemes []AuthenticationScheme) int {
+	for _, scheme := range schemes {
+		available |= authSchemeMethods[scheme.Scheme]
+	}
+
+	switch {
+	case available&authDigest != 0:
+		return authDigest
+	case available&authBasic != 0:
+		return authBasic
+	case len(schemes) > 0:
+		// Authentication is required, but with schemes which are not supported.
+		return authUnknown
+	default:
+		return authNone
+	}
+}
+
+// parseAuthenticationSchemes returns the schemes offered in the WWW-Authenticate
+// headers among the given response headers, as they are passed to the header
+// function of a handle.
+func parseAuthenticationSchemes(headers string) []AuthenticationScheme {
+	header := make(textproto.MIMEHeader)
+
+	scanner := bufio.NewScanner(strings.NewReader(headers))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(parts[0]))
+		header.Add(key, strings.TrimSpace(parts[1]))
+	}
+
+	var schemes []AuthenticationScheme
+	seen := make(map[AuthenticationScheme]bool)
+	for _, challenge := range parseChallenges(header) {
+		scheme := AuthenticationScheme{
+			Scheme: challenge.scheme,
+			Realm:  challenge.params["realm"],
+		}
+		if seen[scheme] {
+			continue
+		}
+		seen[scheme] = true
+		schemes = append(schemes, scheme)
+	}
+
+	return schemes
+}
@@ -0,0 +1,144 @@
+package cameradar
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// channelPattern is a route pattern used by NVRs to expose each of their channels.
+// Its regular expression captures the channel number and then the sub-stream.
+type channelPattern struct {
+	regexp     *regexp.Regexp
+	subStreams []string
+}
+
+// channelPatterns are the known channel patterns.
+var channelPatterns = []channelPattern{
+	// Hikvision: Streaming/Channels/101 is the main stream of channel 1, and 102 its sub-stream.
+	{
+		regexp:     regexp.MustCompile(`(?i)^streaming/(?:unicast/)?channels/(\d+?)(\d{2})$`),
+		subStreams: []string{"01", "02"},
+	},
+	{
+		regexp:     regexp.MustCompile(`(?i)^h264/ch(\d+)/(main|sub)/av_stream$`),
+		subStreams: []string{"main", "sub"},
+	},
+	// Dahua: subtype 0 is the main stream and 1 the sub-stream.
+	{
+		regexp:     regexp.MustCompile(`(?i)^cam/realmonitor\?channel=(\d+)&subtype=(\d+)`),
+		subStreams: []string{"0", "1"},
+	},
+	{
+		regexp:     regexp.MustCompile(`(?i)^live/ch(\d+)_(\d+)$`),
+		subStreams: []string{"0", "1"},
+	},
+}
+
+// channelRoute is a route of a channel.
+type channelRoute struct {
+	route   string
+	channel int
+}
+
+// siblingRoutes returns the routes of every channel and sub-stream of the channel
+// pattern matched by the given route, including the route itself, and the channel
+// of the given route. It returns no routes if the route matches no channel pattern.
+func siblingRoutes(route string, first, last int) ([]channelRoute, int) {
+	for _, pattern := range channelPatterns {
+		indexes := pattern.regexp.FindStringSubmatchIndex(route)
+		if indexes == nil {
+			continue
+		}
+
+		channelStart, channelEnd := indexes[2], indexes[3]
+		streamStart, streamEnd := indexes[4], indexes[5]
+
+		channel, err := strconv.Atoi(route[channelStart:channelEnd])
+		if err != nil {
+			return nil, 0
+		}
+
+		var siblings []channelRoute
+		for c := first; c <= last; c++ {
+			for _, subStream := range pattern.subStreams {
+				siblings = append(siblings, channelRoute{
+					route: fmt.Sprintf("%s%0*d%s%s%s",
+						route[:channelStart],
+						channelEnd-channelStart, c,
+						route[channelEnd:streamStart],
+						subStream,
+						route[streamEnd:],
+					),
+					channel: c,
+				})
+			}
+		}
+
+		return siblings, channel
+	}
+
+	return nil, 0
+}
+
+// EnumerateChannels attempts to find the other channels and sub-streams of the
+// provided targets' routes which follow a known NVR channel pattern.
+func (s *Scanner) EnumerateChannels(targets []Stream) []Stream {
+	return s.EnumerateChannelsContext(context.Background(), targets)
+}
+
+// EnumerateChannelsContext is like EnumerateChannels, but stops enumerating
+// channels once the given context is done.
+func (s *Scanner) EnumerateChannelsContext(ctx context.Context, targets []Stream) []Stream {
+	return s.attackStreams(targets, func(target Stream) Stream {
+		return s.enumerateCameraChannels(ctx, target)
+	})
+}
+
+func (s *Scanner) enumerateCameraChannels(ctx context.Context, target Stream) Stream {
+	// Any route gives access to these streams, so all channels would be found.
+	if target.RouteBehavior == RouteBehaviorAcceptAll {
+		return target
+	}
+
+	known := make(map[string]bool)
+	for _, route := range target.ValidRoutes {
+		known[route.Route] = true
+	}
+
+	var candidates []channelRoute
+	for i, route := range target.ValidRoutes {
+		siblings, channel := siblingRoutes(route.Route, s.firstChannel, s.lastChannel)
+		if siblings == nil {
+			continue
+		}
+
+		target.ValidRoutes[i].Channel = channel
+
+		for _, sibling := range siblings {
+			if known[sibling.route] {
+				continue
+			}
+			known[sibling.route] = true
+			candidates = append(candidates, sibling)
+		}
+	}
+
+	found := make([]bool, len(candidates))
+	s.attemptAll(ctx, target, len(candidates), func(i int) bool {
+		found[i] = s.routeAttack(ctx, target, candidates[i].route)
+		return false
+	})
+
+	for i, candidate := range candidates {
+		if found[i] {
+			target.ValidRoutes = append(target.ValidRoutes, ValidRoute{
+				Route:   candidate.route,
+				Channel: candidate.channel,
+			})
+		}
+	}
+
+	return target
+}
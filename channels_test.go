@@ -0,0 +1,130 @@
+package cameradar
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiblingRoutes(t *testing.T) {
+	tests := []struct {
+		description string
+
+		route string
+
+		expectedSiblings []channelRoute
+		expectedChannel  int
+	}{
+		{
+			description: "hikvision channels",
+
+			route: "Streaming/Channels/102",
+
+			expectedSiblings: []channelRoute{
+				{route: "Streaming/Channels/101", channel: 1},
+				{route: "Streaming/Channels/102", channel: 1},
+				{route: "Streaming/Channels/201", channel: 2},
+				{route: "Streaming/Channels/202", channel: 2},
+			},
+			expectedChannel: 1,
+		},
+		{
+			description: "hikvision h264 channels",
+
+			route: "h264/ch2/main/av_stream",
+
+			expectedSiblings: []channelRoute{
+				{route: "h264/ch1/main/av_stream", channel: 1},
+				{route: "h264/ch1/sub/av_stream", channel: 1},
+				{route: "h264/ch2/main/av_stream", channel: 2},
+				{route: "h264/ch2/sub/av_stream", channel: 2},
+			},
+			expectedChannel: 2,
+		},
+		{
+			description: "dahua channels",
+
+			route: "cam/realmonitor?channel=1&subtype=0&unicast=true",
+
+			expectedSiblings: []channelRoute{
+				{route: "cam/realmonitor?channel=1&subtype=0&unicast=true", channel: 1},
+				{route: "cam/realmonitor?channel=1&subtype=1&unicast=true", channel: 1},
+				{route: "cam/realmonitor?channel=2&subtype=0&unicast=true", channel: 2},
+				{route: "cam/realmonitor?channel=2&subtype=1&unicast=true", channel: 2},
+			},
+			expectedChannel: 1,
+		},
+		{
+			description: "padded channels",
+
+			route: "live/ch01_0",
+
+			expectedSiblings: []channelRoute{
+				{route: "live/ch01_0", channel: 1},
+				{route: "live/ch01_1", channel: 1},
+				{route: "live/ch02_0", channel: 2},
+				{route: "live/ch02_1", channel: 2},
+			},
+			expectedChannel: 1,
+		},
+		{
+			description: "route without channels",
+
+			route: "live.sdp",
+		},
+		{
+			description: "channel without sub-stream",
+
+			route: "Streaming/Channels/1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			siblings, channel := siblingRoutes(test.route, 1, 2)
+
+			assert.Equal(t, test.expectedSiblings, siblings)
+			assert.Equal(t, test.expectedChannel, channel)
+		})
+	}
+}
+
+func TestEnumerateCameraChannels(t *testing.T) {
+	server := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		for _, route := range []string{"/Streaming/Channels/101", "/Streaming/Channels/102", "/Streaming/Channels/301"} {
+			if strings.HasSuffix(req.uri, route) {
+				return fakeOK
+			}
+		}
+		return fakeNotFound
+	})
+	defer server.close()
+
+	scanner := &Scanner{
+		term:         disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		curl:         NewRTSPClient(),
+		timeout:      time.Second,
+		firstChannel: 1,
+		lastChannel:  4,
+	}
+
+	target := server.stream(t)
+	target.ValidRoutes = []ValidRoute{
+		{Route: "live.sdp"},
+		{Route: "Streaming/Channels/101"},
+	}
+
+	result := scanner.enumerateCameraChannels(context.Background(), target)
+
+	assert.Equal(t, []ValidRoute{
+		{Route: "live.sdp"},
+		{Route: "Streaming/Channels/101", Channel: 1},
+		{Route: "Streaming/Channels/102", Channel: 1},
+		{Route: "Streaming/Channels/301", Channel: 3},
+	}, result.ValidRoutes)
+}
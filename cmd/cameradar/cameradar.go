@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
-	"net"
 
 	"github.com/Ullaakut/cameradar"
 	"github.com/Ullaakut/disgo"
@@ -14,10 +17,14 @@ import (
 	"github.com/spf13/viper"
 )
 
+// exitInterrupted is the exit code used when cameradar is interrupted
+// by a signal, following the 128+SIGINT shell convention.
+const exitInterrupted = 130
 
-// IP4V addresses don't usually have semicolons, not the best solution but works
+// IsIpv4Net returns whether the given address is an IPv4 address.
 func IsIpv4Net(address string) bool {
-   return strings.Count(address, ":") < 2
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() != nil
 }
 
 func getLocalNetworks() []string {
@@ -25,14 +32,14 @@ func getLocalNetworks() []string {
 	netInterfaces, err := net.InterfaceAddrs()
 	// remove all IPv6 and localhost
 	if err == nil {
-		for _, netInterface := range netInterfaces {	
-				addr := strings.Split(netInterface.String(), "/")[0]
-				if IsIpv4Net(addr) && strings.Contains(addr, "192.168.") {
-					networks = append(networks, netInterface.String())
-				}
+		for _, netInterface := range netInterfaces {
+			addr := strings.Split(netInterface.String(), "/")[0]
+			if IsIpv4Net(addr) && strings.Contains(addr, "192.168.") {
+				networks = append(networks, netInterface.String())
+			}
 		}
 	}
-   return networks
+	return networks
 }
 
 func parseArguments() error {
@@ -40,18 +47,34 @@ func parseArguments() error {
 	viper.SetEnvPrefix("cameradar")
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 
-	pflag.StringSliceP("targets", "t", []string{},"The targets on which to scan for open RTSP streams - required (ex: 172.16.100.0/24)")
+	pflag.StringSliceP("targets", "t", []string{}, "The targets on which to scan for open RTSP streams - required (ex: 172.16.100.0/24)")
 	pflag.StringSliceP("ports", "p", []string{"554", "5554", "8554"}, "The ports on which to search for RTSP streams")
+	pflag.StringP("custom-credentials", "c", "${GOPATH}/src/github.com/Ullaakut/cameradar/dictionaries/credentials.json", "The path on which to load a custom credentials JSON dictionary")
 	pflag.StringP("custom-routes", "r", "${GOPATH}/src/github.com/Ullaakut/cameradar/dictionaries/routes", "The path on which to load a custom routes dictionary")
 	pflag.IntP("scan-speed", "s", 4, "The nmap speed preset to use for scanning (lower is stealthier)")
 	pflag.DurationP("attack-interval", "I", 0, "The interval between each attack  (i.e: 2000ms, higher is stealthier)")
+	pflag.Int("max-concurrency", 100, "The maximum amount of attack requests running at the same time")
+	pflag.Int("max-host-concurrency", 1, "The maximum amount of attack requests running at the same time on a single host")
 	pflag.DurationP("timeout", "T", 2000*time.Millisecond, "The timeout to use for attack attempts (i.e: 2000ms)")
+	pflag.Int("first-channel", 1, "The first channel to try in routes containing the {channel} placeholder and on NVRs")
+	pflag.Int("last-channel", 16, "The last channel to try in routes containing the {channel} placeholder and on NVRs")
+	pflag.Bool("validate-playback", false, "Only consider streams available once media is received from them")
 	pflag.BoolP("debug", "d", true, "Enable the debug logs")
 	pflag.BoolP("verbose", "v", false, "Enable the verbose logs")
+	pflag.Bool("native-rtsp", false, "Use the built-in RTSP client instead of libcurl")
+	pflag.Bool("tls-insecure", false, "Do not verify the certificates of RTSPS streams")
+	pflag.String("tls-ca-bundle", "", "The path of a PEM bundle of certificate authorities to trust for RTSPS streams")
+	pflag.Bool("http-tunnel", false, "Attack the HTTP ports found by tunneling RTSP in HTTP")
+	pflag.Bool("connect-scan", false, "Use the built-in TCP connect scanner instead of nmap")
+	pflag.Bool("verify-services", false, "Send an RTSP request to open ports that were not identified as RTSP")
+	pflag.Bool("discover", false, "Find ONVIF cameras using WS-Discovery instead of scanning the targets")
+	pflag.Bool("onvif", false, "Retrieve the stream URIs of ONVIF cameras before attacking their routes")
+	pflag.Bool("onvif-inventory", false, "Retrieve the device information and capabilities of ONVIF cameras")
+	pflag.StringSlice("discovery-interfaces", []string{}, "The network interfaces on which to send WS-Discovery probes (ex: eth0)")
 	pflag.BoolP("help", "h", false, "displays this help message")
 
-	pflag.StringP("username", "u", "admin", "Username for the camera")
-	pflag.StringP("password", "P", "", "Password for the camera")
+	pflag.StringP("username", "u", "admin", "Username for the camera, tried before the credentials dictionary")
+	pflag.StringP("password", "P", "", "Password for the camera, tried before the credentials dictionary")
 	viper.AutomaticEnv()
 
 	pflag.Parse()
@@ -72,17 +95,17 @@ func parseArguments() error {
 	}
 
 	targets := viper.GetStringSlice("targets")
-	if len(targets) == 0 {
+	if len(targets) == 0 && !viper.GetBool("discover") {
 		fmt.Println("\nNo targets provided. Detecting networks.. automatically.")
 		auto_networks := getLocalNetworks()
 		fmt.Println("\nThe following range(s) will be scanned: ")
 		fmt.Println(auto_networks)
 		targets = auto_networks
 	}
-    viper.Set("targets", targets)
+	viper.Set("targets", targets)
 
 	if viper.GetString("password") == "" {
-		fmt.Println("\nTNo password was provided. Empty password will be used.")
+		fmt.Println("\nNo password was provided. An empty password will be tried before the credentials dictionary.")
 	}
 
 	return nil
@@ -99,28 +122,78 @@ func main() {
 		cameradar.WithPorts(viper.GetStringSlice("ports")),
 		cameradar.WithDebug(viper.GetBool("debug")),
 		cameradar.WithVerbose(viper.GetBool("verbose")),
+		cameradar.WithNativeRTSP(viper.GetBool("native-rtsp")),
+		cameradar.WithCustomCredentials(viper.GetString("custom-credentials")),
 		cameradar.WithCustomRoutes(viper.GetString("custom-routes")),
 		cameradar.WithScanSpeed(viper.GetInt("scan-speed")),
 		cameradar.WithAttackInterval(viper.GetDuration("attack-interval")),
 		cameradar.WithTimeout(viper.GetDuration("timeout")),
+		cameradar.WithMaxConcurrency(viper.GetInt("max-concurrency")),
+		cameradar.WithMaxHostConcurrency(viper.GetInt("max-host-concurrency")),
 		cameradar.WithUsername(viper.GetString("username")),
 		cameradar.WithPassword(viper.GetString("password")),
+		cameradar.WithChannelRange(viper.GetInt("first-channel"), viper.GetInt("last-channel")),
+		cameradar.WithPlaybackValidation(viper.GetBool("validate-playback")),
+		cameradar.WithTLSInsecure(viper.GetBool("tls-insecure")),
+		cameradar.WithTLSCABundle(viper.GetString("tls-ca-bundle")),
+		cameradar.WithHTTPTunnel(viper.GetBool("http-tunnel")),
+		cameradar.WithConnectScan(viper.GetBool("connect-scan")),
+		cameradar.WithServiceVerification(viper.GetBool("verify-services")),
+		cameradar.WithDiscoveryInterfaces(viper.GetStringSlice("discovery-interfaces")),
+		cameradar.WithONVIF(viper.GetBool("onvif")),
+		cameradar.WithONVIFInventory(viper.GetBool("onvif-inventory")),
 	)
 	if err != nil {
 		printErr(err)
 	}
 
-	scanResult, err := c.Scan()
-	if err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handleSignals(cancel)
+
+	var scanResult []cameradar.Stream
+	if viper.GetBool("discover") {
+		scanResult, err = c.DiscoverContext(ctx)
+	} else {
+		scanResult, err = c.ScanContext(ctx)
+	}
+	interrupted := err != nil && ctx.Err() != nil
+	if err != nil && !interrupted {
 		printErr(err)
 	}
 
-	streams, err := c.Attack(scanResult)
-	if err != nil {
-		printErr(err)
+	// When the scan was interrupted, the attack never runs and the streams
+	// found by the scan are printed as they are.
+	streams := scanResult
+	if !interrupted {
+		streams, err = c.AttackContext(ctx, scanResult)
+		interrupted = err != nil && ctx.Err() != nil
+		if err != nil && !interrupted {
+			printErr(err)
+		}
 	}
 
 	c.PrintStreams(streams)
+
+	if interrupted {
+		os.Exit(exitInterrupted)
+	}
+}
+
+// handleSignals cancels the running scan or attack on SIGINT or SIGTERM, so that
+// the results gathered so far can be printed. A second signal exits immediately.
+func handleSignals(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		disgo.Errorln(style.Failure("\nInterrupted, stopping and printing the results found so far. Interrupt again to exit immediately."))
+		cancel()
+
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
 }
 
 func printErr(err error) {
@@ -1,25 +1,57 @@
 package cameradar
 
-import (
-	curl "github.com/Ullaakut/go-curl"
-)
+// CurlInfo identifies a piece of information that can be retrieved from a
+// Curler after a request was performed.
+type CurlInfo int
 
 // Curler is an interface that implements the CURL interface of the go-curl library
 // Used for mocking
 type Curler interface {
 	Setopt(opt int, param interface{}) error
 	Perform() error
-	Getinfo(info curl.CurlInfo) (interface{}, error)
+	Getinfo(info CurlInfo) (interface{}, error)
 	Duphandle() Curler
 }
 
-// Curl is a libcurl wrapper used to make the Curler interface work even though
-// golang currently does not support covariance (see https://github.com/golang/go/issues/7512)
-type Curl struct {
-	*curl.CURL
-}
+// libcurl options used by cameradar. Their values are the ones from curl.h, so
+// that they can be passed as-is to libcurl while not requiring cgo to be used
+// by the native RTSP client.
+const (
+	optTimeoutMS      = 155
+	optNoSignal       = 99
+	optNoBody         = 44
+	optNoProgress     = 43
+	optSSLVerifyPeer  = 64
+	optSSLVerifyHost  = 81
+	optHTTPAuth       = 107
+	optRTSPRequest    = 189
+	optURL            = 10002
+	optUserPwd        = 10005
+	optCAInfo         = 10065
+	optRTSPStreamURI  = 10191
+	optRTSPTransport  = 10192
+	optWriteFunction  = 20011
+	optHeaderFunction = 20079
+	optProgressFunc   = 20056
+	// optInterleaveFunc is not supported by the libcurl binding.
+	optInterleaveFunc = 20196
+	// optHTTPTunnel is not a libcurl option. It is only supported by the native
+	// RTSP client, which tunnels RTSP in HTTP when it is set to 1.
+	optHTTPTunnel = 90001
+)
 
-// Duphandle wraps curl.Duphandle
-func (c *Curl) Duphandle() Curler {
-	return &Curl{c.CURL.Duphandle()}
-}
+// libcurl infos used by cameradar.
+const (
+	infoResponseCode  CurlInfo = 0x200002
+	infoHTTPAuthAvail CurlInfo = 0x200017
+	// infoCertInfo is only supported by the native RTSP client, which returns
+	// the certificate chain of the server as a []*x509.Certificate.
+	infoCertInfo CurlInfo = 0x400022
+)
+
+// libcurl authentication methods.
+const (
+	authNone   = 0
+	authBasic  = 1
+	authDigest = 2
+)
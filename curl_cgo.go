@@ -0,0 +1,50 @@
+//go:build cgo
+// +build cgo
+
+package cameradar
+
+import (
+	"fmt"
+
+	curl "github.com/Ullaakut/go-curl"
+)
+
+// Curl is a libcurl wrapper used to make the Curler interface work even though
+// golang currently does not support covariance (see https://github.com/golang/go/issues/7512)
+type Curl struct {
+	*curl.CURL
+}
+
+// Setopt wraps curl.Setopt. Unlike the native RTSP client, the libcurl binding
+// does not support setting an interleave function.
+func (c *Curl) Setopt(opt int, param interface{}) error {
+	if opt == optInterleaveFunc {
+		return fmt.Errorf("option %d is not supported by the libcurl binding", opt)
+	}
+	return c.CURL.Setopt(opt, param)
+}
+
+// Getinfo wraps curl.Getinfo
+func (c *Curl) Getinfo(info CurlInfo) (interface{}, error) {
+	return c.CURL.Getinfo(curl.CurlInfo(info))
+}
+
+// Duphandle wraps curl.Duphandle
+func (c *Curl) Duphandle() Curler {
+	return &Curl{c.CURL.Duphandle()}
+}
+
+// newCurl initializes libcurl and returns a handle to it.
+func newCurl() (Curler, error) {
+	err := curl.GlobalInit(curl.GLOBAL_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize curl library: %v", err)
+	}
+
+	handle := curl.EasyInit()
+	if handle == nil {
+		return nil, fmt.Errorf("unable to initialize curl handle: %v", err)
+	}
+
+	return &Curl{CURL: handle}, nil
+}
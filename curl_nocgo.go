@@ -0,0 +1,10 @@
+//go:build !cgo
+// +build !cgo
+
+package cameradar
+
+// newCurl returns the native RTSP client, since libcurl can't be used
+// in binaries built without cgo.
+func newCurl() (Curler, error) {
+	return NewRTSPClient(), nil
+}
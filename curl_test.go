@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package cameradar
 
 import (
@@ -5,6 +8,7 @@ import (
 	"testing"
 
 	curl "github.com/Ullaakut/go-curl"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestCurl(t *testing.T) {
@@ -18,3 +22,50 @@ func TestCurl(t *testing.T) {
 		t.Errorf("unexpected identical handle from duphandle: expected %+v got %+v", handle, handle2)
 	}
 }
+
+func TestNewCurl(t *testing.T) {
+	tests := []struct {
+		description string
+
+		curlGlobalFail bool
+		curlEasyFail   bool
+
+		expectedErr bool
+	}{
+		{
+			description: "no error",
+		},
+		{
+			description: "curl fails to init",
+
+			curlGlobalFail: true,
+
+			expectedErr: true,
+		},
+		{
+			description: "curl fails to create handle",
+
+			curlEasyFail: true,
+
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			curl.TestGlobalFail = test.curlGlobalFail
+			curl.TestEasyFail = test.curlEasyFail
+			defer func() {
+				curl.TestGlobalFail = false
+				curl.TestEasyFail = false
+			}()
+
+			_, err := newCurl()
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
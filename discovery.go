@@ -0,0 +1,301 @@
+package cameradar
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// wsDiscoveryAddress is the multicast address on which WS-Discovery probes are sent.
+	wsDiscoveryAddress = "239.255.255.250:3702"
+
+	// defaultDiscoveryTimeout is how long probe matches are waited for when no
+	// timeout was given.
+	defaultDiscoveryTimeout = 3 * time.Second
+
+	// onvifRTSPPort is the port of the streams of the cameras found by WS-Discovery,
+	// since ONVIF only announces the address of their web services.
+	onvifRTSPPort uint16 = 554
+
+	// onvifScopePrefix is the prefix of the scopes defined by ONVIF.
+	onvifScopePrefix = "onvif://www.onvif.org/"
+)
+
+// wsDiscoveryProbe is a WS-Discovery probe for ONVIF network video transmitters,
+// which are cameras and encoders. It is formatted with the message ID of the probe.
+const wsDiscoveryProbe = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<s:Header>
+<a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>
+<a:MessageID>%s</a:MessageID>
+<a:ReplyTo><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo>
+<a:To s:mustUnderstand="1">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To>
+</s:Header>
+<s:Body>
+<d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe>
+</s:Body>
+</s:Envelope>`
+
+// probeMatches is the envelope of a WS-Discovery ProbeMatches message.
+type probeMatches struct {
+	RelatesTo string       `xml:"Header>RelatesTo"`
+	Matches   []probeMatch `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+// probeMatch describes a camera which answered a probe, from the given address.
+type probeMatch struct {
+	Endpoint string `xml:"EndpointReference>Address"`
+	Scopes   string `xml:"Scopes"`
+	XAddrs   string `xml:"XAddrs"`
+
+	from string
+}
+
+// Discover finds the ONVIF cameras of the local networks using WS-Discovery,
+// by sending a multicast probe on the discovery interfaces and waiting for the
+// cameras to answer it. The streams it returns can be attacked like the ones
+// found by Scan.
+func (s *Scanner) Discover() ([]Stream, error) {
+	return s.DiscoverContext(context.Background())
+}
+
+// DiscoverContext is like Discover, but stops waiting for cameras when the given
+// context is done, in which case the context's error is returned along with the
+// cameras that answered before the interruption, if any.
+func (s *Scanner) DiscoverContext(ctx context.Context) ([]Stream, error) {
+	s.term.StartStep("Discovering ONVIF cameras")
+
+	addresses, err := discoveryAddresses(s.discoveryInterfaces)
+	if err != nil {
+		return nil, s.term.FailStepf("unable to find discovery interfaces: %v", err)
+	}
+
+	return s.discover(ctx, addresses, wsDiscoveryAddress)
+}
+
+// discover sends a WS-Discovery probe to the given group address from each of the
+// given local addresses, and returns the streams of the cameras that answered.
+func (s *Scanner) discover(ctx context.Context, localAddresses []string, groupAddress string) ([]Stream, error) {
+	group, err := net.ResolveUDPAddr("udp", groupAddress)
+	if err != nil {
+		return nil, s.term.FailStepf("invalid discovery address %q: %v", groupAddress, err)
+	}
+
+	timeout := s.timeout
+	if timeout == 0 {
+		timeout = defaultDiscoveryTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	var conns []*net.UDPConn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	messageID := "urn:uuid:" + randomUUID()
+	probe := []byte(fmt.Sprintf(wsDiscoveryProbe, messageID))
+	for _, address := range localAddresses {
+		// Sending from an address of an interface sends the probe on that interface.
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(address)})
+		if err != nil {
+			s.term.Errorf("Unable to listen on %s: %v\n", address, err)
+			continue
+		}
+		conns = append(conns, conn)
+
+		_, err = conn.WriteToUDP(probe, group)
+		if err != nil {
+			s.term.Errorf("Unable to send discovery probe from %s: %v\n", address, err)
+		}
+	}
+
+	if len(conns) == 0 {
+		return nil, s.term.FailStep(errors.New("unable to send discovery probes"))
+	}
+
+	results := make(chan []probeMatch, len(conns))
+	for _, conn := range conns {
+		go func(conn *net.UDPConn) {
+			results <- s.receiveProbeMatches(ctx, conn, messageID, deadline)
+		}(conn)
+	}
+
+	// Cameras are told apart by their endpoint, since they might answer on several interfaces.
+	var streams []Stream
+	seen := make(map[string]bool)
+	for range conns {
+		for _, match := range <-results {
+			key := match.Endpoint
+			if key == "" {
+				key = match.from
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			streams = append(streams, match.stream())
+		}
+	}
+
+	if ctx.Err() != nil {
+		return streams, s.term.FailStep(ctx.Err())
+	}
+
+	s.term.Debugf("Found %d ONVIF cameras\n", len(streams))
+
+	s.term.EndStep()
+
+	return streams, nil
+}
+
+// receiveProbeMatches reads the answers to the probe with the given message ID
+// until the deadline.
+func (s *Scanner) receiveProbeMatches(ctx context.Context, conn *net.UDPConn, messageID string, deadline time.Time) []probeMatch {
+	stop := unblockOnDone(ctx, conn)
+	defer stop()
+
+	var received []probeMatch
+	buf := make([]byte, 65536)
+	for {
+		err := conn.SetReadDeadline(deadline)
+		if err != nil {
+			return received
+		}
+
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return received
+		}
+
+		var matches probeMatches
+		err = xml.Unmarshal(buf[:n], &matches)
+		if err != nil {
+			s.term.Debugf("Ignoring invalid discovery message from %s: %v\n", from.IP, err)
+			continue
+		}
+
+		if matches.RelatesTo != "" && strings.TrimSpace(matches.RelatesTo) != messageID {
+			continue
+		}
+
+		for _, match := range matches.Matches {
+			match.Endpoint = strings.TrimSpace(match.Endpoint)
+			match.from = from.IP.String()
+			received = append(received, match)
+		}
+	}
+}
+
+// stream returns the stream of the camera described by the probe match.
+func (m probeMatch) stream() Stream {
+	stream := Stream{
+		Address: m.from,
+		Port:    onvifRTSPPort,
+		XAddrs:  strings.Fields(m.XAddrs),
+		Scopes:  strings.Fields(m.Scopes),
+	}
+
+	// The address of the camera is the one of its web services, which might
+	// not be the one it sent its answer from.
+	for _, xaddr := range stream.XAddrs {
+		u, err := url.Parse(xaddr)
+		if err == nil && net.ParseIP(u.Hostname()) != nil {
+			stream.Address = u.Hostname()
+			break
+		}
+	}
+
+	var name, hardware string
+	for _, scope := range stream.Scopes {
+		switch {
+		case strings.HasPrefix(scope, onvifScopePrefix+"name/"):
+			name = scopeValue(scope, onvifScopePrefix+"name/")
+		case strings.HasPrefix(scope, onvifScopePrefix+"hardware/"):
+			hardware = scopeValue(scope, onvifScopePrefix+"hardware/")
+		}
+	}
+
+	// The name of cameras often already contains their model.
+	stream.Device = name
+	if !strings.Contains(name, hardware) {
+		stream.Device = strings.TrimSpace(name + " " + hardware)
+	}
+
+	return stream
+}
+
+// scopeValue returns the unescaped value of the given scope.
+func scopeValue(scope, prefix string) string {
+	value := strings.TrimPrefix(scope, prefix)
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	return unescaped
+}
+
+// discoveryAddresses returns the IPv4 addresses of the given interfaces, or of
+// every interface which is up and supports multicast when none are given.
+func discoveryAddresses(names []string) ([]string, error) {
+	var interfaces []net.Interface
+	if len(names) == 0 {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, iface := range all {
+			if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 && iface.Flags&net.FlagLoopback == 0 {
+				interfaces = append(interfaces, iface)
+			}
+		}
+	} else {
+		for _, name := range names {
+			iface, err := net.InterfaceByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("unknown interface %q", name)
+			}
+			interfaces = append(interfaces, *iface)
+		}
+	}
+
+	var addresses []string
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the addresses of %q: %v", iface.Name, err)
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.To4() != nil {
+				addresses = append(addresses, ipNet.IP.String())
+			}
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil, errors.New("no interface with an IPv4 address")
+	}
+
+	return addresses, nil
+}
+
+// randomUUID returns a random version 4 UUID.
+func randomUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
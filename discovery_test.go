@@ -0,0 +1,216 @@
+package cameradar
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeProbeMatch = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<SOAP-ENV:Header>
+<wsa:MessageID>urn:uuid:%s</wsa:MessageID>
+<wsa:RelatesTo>%s</wsa:RelatesTo>
+<wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/ProbeMatches</wsa:Action>
+</SOAP-ENV:Header>
+<SOAP-ENV:Body>
+<d:ProbeMatches>
+<d:ProbeMatch>
+<wsa:EndpointReference><wsa:Address>%s</wsa:Address></wsa:EndpointReference>
+<d:Types>dn:NetworkVideoTransmitter</d:Types>
+<d:Scopes>%s</d:Scopes>
+<d:XAddrs>%s</d:XAddrs>
+<d:MetadataVersion>1</d:MetadataVersion>
+</d:ProbeMatch>
+</d:ProbeMatches>
+</SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+var messageIDRegexp = regexp.MustCompile(`<a:MessageID>(.*)</a:MessageID>`)
+
+// fakeCamera is how a fake camera answers WS-Discovery probes. When relatesTo is
+// empty, the message ID of the probe is used.
+type fakeCamera struct {
+	endpoint  string
+	relatesTo string
+	scopes    string
+	xaddrs    string
+}
+
+// newFakeDiscoveryResponder answers each WS-Discovery probe it receives with the
+// probe matches of the given cameras, as well as with an invalid message.
+func newFakeDiscoveryResponder(t *testing.T, cameras ...fakeCamera) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("unable to start fake discovery responder: %v", err)
+	}
+
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			match := messageIDRegexp.FindSubmatch(buf[:n])
+			if match == nil {
+				continue
+			}
+
+			_, _ = conn.WriteToUDP([]byte("not a SOAP message"), from)
+			for _, camera := range cameras {
+				relatesTo := camera.relatesTo
+				if relatesTo == "" {
+					relatesTo = string(match[1])
+				}
+
+				answer := fmt.Sprintf(fakeProbeMatch, randomUUID(), relatesTo, camera.endpoint, camera.scopes, camera.xaddrs)
+				_, _ = conn.WriteToUDP([]byte(answer), from)
+			}
+		}
+	}()
+
+	return conn
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		description string
+
+		cameras []fakeCamera
+
+		expectedStreams []Stream
+	}{
+		{
+			description: "cameras found",
+
+			cameras: []fakeCamera{
+				{
+					endpoint: "urn:uuid:a3cf5c35-1d9c-4a7b-9d6f-d8b0ffe2e8f1",
+					scopes:   "onvif://www.onvif.org/type/video_encoder onvif://www.onvif.org/hardware/DS-2CD2032-I onvif://www.onvif.org/name/HIKVISION",
+					xaddrs:   "http://172.16.100.10/onvif/device_service http://[fd00::10]/onvif/device_service",
+				},
+				{
+					endpoint: "urn:uuid:5b2a6d0e-8f3c-4e2b-a1d9-7c6e0f4b3a21",
+					scopes:   "onvif://www.onvif.org/name/AXIS%20P1346 onvif://www.onvif.org/hardware/P1346",
+					xaddrs:   "http://camera.local/onvif/device_service",
+				},
+			},
+
+			expectedStreams: []Stream{
+				{
+					Device:  "HIKVISION DS-2CD2032-I",
+					Address: "172.16.100.10",
+					Port:    554,
+					XAddrs:  []string{"http://172.16.100.10/onvif/device_service", "http://[fd00::10]/onvif/device_service"},
+					Scopes:  []string{"onvif://www.onvif.org/type/video_encoder", "onvif://www.onvif.org/hardware/DS-2CD2032-I", "onvif://www.onvif.org/name/HIKVISION"},
+				},
+				{
+					Device:  "AXIS P1346",
+					Address: "127.0.0.1",
+					Port:    554,
+					XAddrs:  []string{"http://camera.local/onvif/device_service"},
+					Scopes:  []string{"onvif://www.onvif.org/name/AXIS%20P1346", "onvif://www.onvif.org/hardware/P1346"},
+				},
+			},
+		},
+		{
+			description: "duplicate answers are ignored",
+
+			cameras: []fakeCamera{
+				{endpoint: "urn:uuid:a3cf5c35-1d9c-4a7b-9d6f-d8b0ffe2e8f1"},
+				{endpoint: "urn:uuid:a3cf5c35-1d9c-4a7b-9d6f-d8b0ffe2e8f1"},
+			},
+
+			expectedStreams: []Stream{
+				{Address: "127.0.0.1", Port: 554, XAddrs: []string{}, Scopes: []string{}},
+			},
+		},
+		{
+			description: "answers to other probes are ignored",
+
+			cameras: []fakeCamera{
+				{endpoint: "urn:uuid:a3cf5c35-1d9c-4a7b-9d6f-d8b0ffe2e8f1", relatesTo: "urn:uuid:other"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			responder := newFakeDiscoveryResponder(t, test.cameras...)
+			defer responder.Close()
+
+			scanner := &Scanner{
+				term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				timeout: 200 * time.Millisecond,
+			}
+
+			streams, err := scanner.discover(context.Background(), []string{"127.0.0.1"}, responder.LocalAddr().String())
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedStreams, streams)
+		})
+	}
+}
+
+func TestDiscoverInterrupted(t *testing.T) {
+	responder := newFakeDiscoveryResponder(t)
+	defer responder.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	scanner := &Scanner{
+		term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		timeout: time.Minute,
+	}
+
+	streams, err := scanner.discover(ctx, []string{"127.0.0.1"}, responder.LocalAddr().String())
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, streams)
+}
+
+func TestDiscoverInterruptedAfterAnswers(t *testing.T) {
+	responder := newFakeDiscoveryResponder(t, fakeCamera{
+		endpoint: "urn:uuid:a3cf5c35-1d9c-4a7b-9d6f-d8b0ffe2e8f1",
+		scopes:   "onvif://www.onvif.org/name/HIKVISION",
+		xaddrs:   "http://172.16.100.10/onvif/device_service",
+	})
+	defer responder.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	scanner := &Scanner{
+		term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		timeout: time.Minute,
+	}
+
+	streams, err := scanner.discover(ctx, []string{"127.0.0.1"}, responder.LocalAddr().String())
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []Stream{
+		{
+			Device:  "HIKVISION",
+			Address: "172.16.100.10",
+			Port:    554,
+			XAddrs:  []string{"http://172.16.100.10/onvif/device_service"},
+			Scopes:  []string{"onvif://www.onvif.org/name/HIKVISION"},
+		},
+	}, streams)
+}
+
+func TestDiscoveryAddresses(t *testing.T) {
+	_, err := discoveryAddresses([]string{"not-an-interface"})
+
+	assert.EqualError(t, err, `unknown interface "not-an-interface"`)
+}
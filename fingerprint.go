@@ -0,0 +1,97 @@
+package cameradar
+
+import (
+	"context"
+	"fmt"
+)
+
+// RouteBehavior describes how a stream answers requests on routes that do not exist.
+type RouteBehavior string
+
+// Route behaviors.
+const (
+	// RouteBehaviorUnknown means that the stream could not be fingerprinted.
+	RouteBehaviorUnknown RouteBehavior = "unknown"
+	// RouteBehaviorNormal means that the stream answers 404 on routes that do not
+	// exist, so routes can be attacked without credentials.
+	RouteBehaviorNormal RouteBehavior = "normal"
+	// RouteBehaviorAuthFirst means that the stream requires authentication before
+	// telling whether a route exists, like GST RTSP Server does, so routes can only
+	// be attacked once credentials are found.
+	RouteBehaviorAuthFirst RouteBehavior = "auth_first"
+	// RouteBehaviorAcceptAll means that the stream accepts any route, so attacking
+	// routes is pointless.
+	RouteBehaviorAcceptAll RouteBehavior = "accept_all"
+)
+
+// canaryCount is the amount of random routes requested to fingerprint a stream.
+const canaryCount = 2
+
+// FingerprintStreams requests routes that can not exist on the provided targets in
+// order to find out how they answer to requests on unknown routes.
+func (s *Scanner) FingerprintStreams(targets []Stream) []Stream {
+	return s.FingerprintStreamsContext(context.Background(), targets)
+}
+
+// FingerprintStreamsContext is like FingerprintStreams, but stops fingerprinting
+// streams once the given context is done.
+func (s *Scanner) FingerprintStreamsContext(ctx context.Context, targets []Stream) []Stream {
+	return s.attackStreams(targets, func(target Stream) Stream {
+		return s.fingerprintCameraStream(ctx, target)
+	})
+}
+
+func (s *Scanner) fingerprintCameraStream(ctx context.Context, target Stream) Stream {
+	codes := make([]int, canaryCount)
+	s.attemptAll(ctx, target, canaryCount, func(i int) bool {
+		codes[i], _ = s.describe(ctx, target, canaryRoute(), target.Username, target.Password)
+		return false
+	})
+
+	// Interrupted fingerprints are not conclusive.
+	if ctx.Err() != nil {
+		return target
+	}
+
+	target.RouteBehavior = routeBehavior(codes)
+
+	s.term.Debugf("Stream %s route behavior: %s\n", GetCameraRTSPURL(target), target.RouteBehavior)
+
+	return target
+}
+
+// routeBehavior returns the route behavior matching the status codes returned
+// for canary routes. Canaries must all be answered the same way for the
+// behavior to be known.
+func routeBehavior(codes []int) RouteBehavior {
+	var behavior RouteBehavior
+	for _, code := range codes {
+		var b RouteBehavior
+		switch code {
+		case -1:
+			return RouteBehaviorUnknown
+		case httpOK:
+			b = RouteBehaviorAcceptAll
+		case httpUnauthorized, httpForbidden:
+			b = RouteBehaviorAuthFirst
+		default:
+			b = RouteBehaviorNormal
+		}
+
+		if behavior != "" && behavior != b {
+			return RouteBehaviorUnknown
+		}
+		behavior = b
+	}
+
+	if behavior == "" {
+		return RouteBehaviorUnknown
+	}
+
+	return behavior
+}
+
+// canaryRoute returns a random route that is not supposed to exist on any camera.
+func canaryRoute() string {
+	return fmt.Sprintf("cameradar-%s", randomHex(8))
+}
@@ -0,0 +1,182 @@
+package cameradar
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteBehavior(t *testing.T) {
+	tests := []struct {
+		description string
+
+		codes []int
+
+		expectedBehavior RouteBehavior
+	}{
+		{
+			description: "not found",
+
+			codes: []int{404, 404},
+
+			expectedBehavior: RouteBehaviorNormal,
+		},
+		{
+			description: "bad request",
+
+			codes: []int{400, 400},
+
+			expectedBehavior: RouteBehaviorNormal,
+		},
+		{
+			description: "unauthorized",
+
+			codes: []int{401, 401},
+
+			expectedBehavior: RouteBehaviorAuthFirst,
+		},
+		{
+			description: "forbidden",
+
+			codes: []int{403, 401},
+
+			expectedBehavior: RouteBehaviorAuthFirst,
+		},
+		{
+			description: "ok",
+
+			codes: []int{200, 200},
+
+			expectedBehavior: RouteBehaviorAcceptAll,
+		},
+		{
+			description: "inconsistent answers",
+
+			codes: []int{200, 404},
+
+			expectedBehavior: RouteBehaviorUnknown,
+		},
+		{
+			description: "failed request",
+
+			codes: []int{404, -1},
+
+			expectedBehavior: RouteBehaviorUnknown,
+		},
+		{
+			description: "no request",
+
+			expectedBehavior: RouteBehaviorUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Equal(t, test.expectedBehavior, routeBehavior(test.codes))
+		})
+	}
+}
+
+func TestAttackRouteBehaviors(t *testing.T) {
+	tests := []struct {
+		description string
+
+		handler func(req fakeRTSPRequest) string
+
+		expectedBehavior RouteBehavior
+		expectedRoutes   []ValidRoute
+		expectedUsername string
+		expectedPassword string
+	}{
+		{
+			description: "normal",
+
+			handler: func(req fakeRTSPRequest) string {
+				if strings.HasSuffix(req.uri, "/live.sdp") {
+					return fakeOK
+				}
+				return fakeNotFound
+			},
+
+			expectedBehavior: RouteBehaviorNormal,
+			expectedRoutes: []ValidRoute{
+				{Route: "live.sdp", CredentialsFound: true, Available: true, Transport: TransportTCP, Username: "admin"},
+			},
+			expectedUsername: "admin",
+		},
+		{
+			description: "authentication before not found",
+
+			handler: func(req fakeRTSPRequest) string {
+				if req.header.Get("Authorization") != basicAuthorization("root", "12345") {
+					return fakeBasic
+				}
+				if strings.HasSuffix(req.uri, "/live.sdp") {
+					return fakeOK
+				}
+				return fakeNotFound
+			},
+
+			expectedBehavior: RouteBehaviorNormal,
+			expectedRoutes: []ValidRoute{
+				{Route: "live.sdp", CredentialsFound: true, Available: true, Transport: TransportTCP, Username: "root", Password: "12345", AuthenticationType: authBasic, AuthenticationSchemes: []AuthenticationScheme{{Scheme: "basic", Realm: "cameradar"}}},
+			},
+			expectedUsername: "root",
+			expectedPassword: "12345",
+		},
+		{
+			description: "authentication required everywhere",
+
+			handler: func(req fakeRTSPRequest) string {
+				return fakeBasic
+			},
+
+			expectedBehavior: RouteBehaviorAuthFirst,
+		},
+		{
+			description: "any route accepted",
+
+			handler: func(req fakeRTSPRequest) string {
+				return fakeOK
+			},
+
+			expectedBehavior: RouteBehaviorAcceptAll,
+			expectedRoutes: []ValidRoute{
+				{Route: "", CredentialsFound: true, Available: true, Transport: TransportTCP, Username: "admin"},
+			},
+			expectedUsername: "admin",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server := newFakeRTSPServer(t, test.handler)
+			defer server.close()
+
+			scanner := &Scanner{
+				term:     disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				curl:     NewRTSPClient(),
+				timeout:  time.Second,
+				username: "admin",
+				routes:   Routes{"media.amp", "live.sdp", "h264"},
+				credentials: Credentials{
+					Usernames: []string{"admin", "root"},
+					Passwords: []string{"admin", "12345"},
+				},
+			}
+
+			results, err := scanner.Attack([]Stream{server.stream(t)})
+
+			assert.NoError(t, err)
+			assert.Len(t, results, 1)
+			assert.Equal(t, test.expectedBehavior, results[0].RouteBehavior)
+			assert.Equal(t, test.expectedRoutes, results[0].ValidRoutes)
+			assert.Equal(t, test.expectedUsername, results[0].Username)
+			assert.Equal(t, test.expectedPassword, results[0].Password)
+		})
+	}
+}
@@ -14,4 +14,5 @@ require (
 	github.com/spf13/viper v1.4.0
 	github.com/stretchr/testify v1.2.2
 	github.com/vbauerster/mpb v3.4.0+incompatible
+	gopkg.in/yaml.v2 v2.2.2
 )
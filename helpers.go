@@ -1,6 +1,11 @@
 package cameradar
 
-import "fmt"
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
 
 func replace(streams []Stream, new Stream) []Stream {
 	var updatedSlice []Stream
@@ -16,12 +21,70 @@ func replace(streams []Stream, new Stream) []Stream {
 	return updatedSlice
 }
 
-// GetCameraRTSPURL generates a stream's RTSP URL.
+// GetCameraRTSPURL generates a stream's RTSP URL, using the credentials of the
+// stream. Use GetRouteRTSPURL for the URL of one of its routes.
 func GetCameraRTSPURL(stream Stream) string {
-	return "rtsp://" + stream.Username + ":" + stream.Password + "@" + stream.Address + ":" + fmt.Sprint(stream.Port) + "/" 
+	return streamURL(stream, stream.Username, stream.Password, "")
+}
+
+// GetRouteRTSPURL generates the RTSP URL of a route of a stream, using the
+// credentials found for that route.
+func GetRouteRTSPURL(stream Stream, route ValidRoute) string {
+	return streamURL(stream, route.Username, route.Password, route.Route)
 }
 
 // GetCameraAdminPanelURL returns the URL to the camera's admin panel.
 func GetCameraAdminPanelURL(stream Stream) string {
-	return "http://" + stream.Address + "/"
+	return "http://" + urlHost(stream.Address) + "/"
+}
+
+// routeStream returns the stream as it is accessed on the given route, with the
+// credentials and authentication method of that route.
+func routeStream(stream Stream, route ValidRoute) Stream {
+	stream.Username = route.Username
+	stream.Password = route.Password
+	stream.AuthenticationType = route.AuthenticationType
+	return stream
+}
+
+// streamURL returns the URL of the given route of the stream. The credentials are
+// percent-encoded, and left out of the URL when they are both empty. Leading slashes
+// of the route are removed, while its query string is kept as it is.
+func streamURL(stream Stream, username, password, route string) string {
+	var userinfo string
+	if username != "" || password != "" {
+		userinfo = url.UserPassword(username, password).String() + "@"
+	}
+
+	host := urlHost(stream.Address) + ":" + strconv.Itoa(int(stream.Port))
+
+	return rtspScheme(stream) + "://" + userinfo + host + "/" + strings.TrimLeft(route, "/")
+}
+
+// urlHost returns the given address as it is written in URLs, in which IPv6
+// addresses are enclosed in brackets and the percent sign of their zone is escaped.
+func urlHost(address string) string {
+	if !strings.Contains(address, ":") {
+		return address
+	}
+	return "[" + strings.Replace(address, "%", "%25", 1) + "]"
+}
+
+// isIPv6 returns whether the given target is an IPv6 address or network, with or
+// without a zone. Hostnames and IPv4 addresses, networks and ranges are not.
+func isIPv6(target string) bool {
+	if i := strings.IndexByte(target, '%'); i >= 0 {
+		target = target[:i]
+	}
+
+	ip := net.ParseIP(target)
+	if ip == nil {
+		var err error
+		ip, _, err = net.ParseCIDR(target)
+		if err != nil {
+			return false
+		}
+	}
+
+	return ip.To4() == nil
 }
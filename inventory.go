@@ -0,0 +1,137 @@
+package cameradar
+
+import (
+	"context"
+	"strings"
+)
+
+// ONVIF inventory requests.
+const (
+	onvifGetDeviceInformation = `<tds:GetDeviceInformation/>`
+	onvifGetServices          = `<tds:GetServices><tds:IncludeCapability>false</tds:IncludeCapability></tds:GetServices>`
+)
+
+// Namespaces of the ONVIF services which tell about the capabilities of cameras.
+const (
+	onvifPTZNamespace       = "http://www.onvif.org/ver20/ptz/wsdl"
+	onvifAnalyticsNamespace = "http://www.onvif.org/ver20/analytics/wsdl"
+)
+
+type deviceInformationResponse struct {
+	Manufacturer    string `xml:"Manufacturer"`
+	Model           string `xml:"Model"`
+	FirmwareVersion string `xml:"FirmwareVersion"`
+	SerialNumber    string `xml:"SerialNumber"`
+	HardwareID      string `xml:"HardwareId"`
+}
+
+type servicesResponse struct {
+	Services []struct {
+		Namespace string `xml:"Namespace"`
+	} `xml:"Service"`
+}
+
+// InventoryONVIFDevices retrieves the device information and capabilities of the
+// ONVIF cameras among the targets. Cameras are accessed with the ONVIF credentials
+// found when retrieving their routes, or else anonymously or with the credentials
+// of their streams.
+func (s *Scanner) InventoryONVIFDevices(targets []Stream) []Stream {
+	return s.InventoryONVIFDevicesContext(context.Background(), targets)
+}
+
+// InventoryONVIFDevicesContext is like InventoryONVIFDevices, but stops sending
+// requests once the given context is done.
+func (s *Scanner) InventoryONVIFDevicesContext(ctx context.Context, targets []Stream) []Stream {
+	return s.attackStreams(targets, func(target Stream) Stream {
+		return s.inventoryCameraONVIF(ctx, target)
+	})
+}
+
+func (s *Scanner) inventoryCameraONVIF(ctx context.Context, target Stream) Stream {
+	client := s.newONVIFClient()
+	defer client.close()
+
+	deviceURL := s.onvifDeviceService(ctx, target, client)
+	if deviceURL == "" {
+		s.term.Debugf("Stream %s has no ONVIF device service\n", GetCameraRTSPURL(target))
+		return target
+	}
+
+	var candidates []credentialPair
+	if target.ONVIF != nil {
+		candidates = append(candidates, credentialPair{target.ONVIF.Username, target.ONVIF.Password})
+	} else {
+		candidates = append(candidates, credentialPair{})
+		if target.Username != "" || target.Password != "" {
+			candidates = append(candidates, credentialPair{target.Username, target.Password})
+		}
+	}
+
+	infos := make([]deviceInformationResponse, len(candidates))
+	c, err := s.onvifLogin(ctx, target, len(candidates), func(c int) error {
+		return client.call(ctx, deviceURL, candidates[c], onvifGetDeviceInformation, &infos[c])
+	})
+	switch {
+	case err == errONVIFUnauthorized:
+		s.term.Debugf("No credentials were accepted by %s\n", deviceURL)
+		return target
+	case err != nil:
+		if ctx.Err() == nil {
+			s.term.Errorf("Unable to retrieve device information of %s: %v\n", deviceURL, err)
+		}
+		return target
+	}
+
+	info := infos[c]
+	device := &ONVIFDevice{
+		URL:             deviceURL,
+		Username:        candidates[c].username,
+		Password:        candidates[c].password,
+		Manufacturer:    strings.TrimSpace(info.Manufacturer),
+		Model:           strings.TrimSpace(info.Model),
+		FirmwareVersion: strings.TrimSpace(info.FirmwareVersion),
+		SerialNumber:    strings.TrimSpace(info.SerialNumber),
+		HardwareID:      strings.TrimSpace(info.HardwareID),
+	}
+
+	var capabilities capabilitiesResponse
+	s.attemptAll(ctx, target, 1, func(int) bool {
+		err = client.call(ctx, deviceURL, candidates[c], onvifGetCapabilities, &capabilities)
+		return true
+	})
+	if err != nil && ctx.Err() == nil {
+		s.term.Errorf("Unable to retrieve capabilities of %s: %v\n", deviceURL, err)
+	}
+
+	device.PTZ = strings.TrimSpace(capabilities.PTZXAddr) != ""
+	device.Analytics = strings.TrimSpace(capabilities.AnalyticsXAddr) != ""
+	device.Audio = capabilities.AudioSources > 0
+	// Cameras with audio outputs play the audio sent on the backchannel of their streams.
+	device.Backchannel = capabilities.AudioOutputs > 0
+
+	// GetServices was only introduced in ONVIF 2.0, so older cameras do not support it.
+	var services servicesResponse
+	s.attemptAll(ctx, target, 1, func(int) bool {
+		err = client.call(ctx, deviceURL, candidates[c], onvifGetServices, &services)
+		return true
+	})
+	if err != nil && ctx.Err() == nil {
+		s.term.Debugf("Unable to retrieve services of %s: %v\n", deviceURL, err)
+	}
+
+	for _, service := range services.Services {
+		namespace := strings.TrimSpace(service.Namespace)
+		device.Services = append(device.Services, namespace)
+
+		switch namespace {
+		case onvifPTZNamespace:
+			device.PTZ = true
+		case onvifAnalyticsNamespace:
+			device.Analytics = true
+		}
+	}
+
+	target.ONVIF = device
+
+	return target
+}
@@ -0,0 +1,110 @@
+package cameradar
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventoryONVIFDevices(t *testing.T) {
+	camera := fakeONVIFCamera{
+		username: "admin",
+		password: "12345",
+	}
+	server := camera.serve(t)
+	defer server.Close()
+
+	legacy := fakeONVIFCamera{
+		username: "admin",
+		password: "12345",
+		legacy:   true,
+	}
+	legacyServer := legacy.serve(t)
+	defer legacyServer.Close()
+
+	deviceURL := server.URL + onvifDevicePath
+	legacyURL := legacyServer.URL + onvifDevicePath
+
+	tests := []struct {
+		description string
+
+		target Stream
+
+		expectedDevice *ONVIFDevice
+	}{
+		{
+			description: "accessed with the ONVIF credentials",
+
+			target: Stream{
+				Address: "127.0.0.1",
+				ONVIF:   &ONVIFDevice{URL: deviceURL, Username: "admin", Password: "12345"},
+			},
+
+			expectedDevice: &ONVIFDevice{
+				URL:             deviceURL,
+				Username:        "admin",
+				Password:        "12345",
+				Manufacturer:    "HIKVISION",
+				Model:           "DS-2CD2032-I",
+				FirmwareVersion: "V5.4.5 build 170124",
+				SerialNumber:    "DS-2CD2032-I20170301AAWR123456789",
+				HardwareID:      "88",
+				PTZ:             true,
+				Audio:           true,
+				Analytics:       true,
+				Backchannel:     true,
+				Services:        []string{"http://www.onvif.org/ver10/device/wsdl", onvifAnalyticsNamespace},
+			},
+		},
+		{
+			description: "accessed with the credentials of the stream",
+
+			target: Stream{
+				Address:  "127.0.0.1",
+				Username: "admin",
+				Password: "12345",
+				XAddrs:   []string{legacyURL},
+			},
+
+			expectedDevice: &ONVIFDevice{
+				URL:             legacyURL,
+				Username:        "admin",
+				Password:        "12345",
+				Manufacturer:    "HIKVISION",
+				Model:           "DS-2CD2032-I",
+				FirmwareVersion: "V5.4.5 build 170124",
+				SerialNumber:    "DS-2CD2032-I20170301AAWR123456789",
+				HardwareID:      "88",
+				PTZ:             true,
+				Audio:           true,
+				Backchannel:     true,
+			},
+		},
+		{
+			description: "credentials not found",
+
+			target: Stream{
+				Address: "127.0.0.1",
+				XAddrs:  []string{deviceURL},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scanner := &Scanner{
+				term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				timeout: time.Second,
+			}
+
+			results := scanner.InventoryONVIFDevices([]Stream{test.target})
+
+			if assert.Len(t, results, 1) {
+				assert.Equal(t, test.expectedDevice, results[0].ONVIF)
+			}
+		})
+	}
+}
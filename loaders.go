@@ -2,11 +2,16 @@ package cameradar
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+
+	yaml "gopkg.in/yaml.v2"
 )
 
 var fs fileSystem = osFS{}
@@ -30,10 +35,37 @@ type osFS struct{}
 func (osFS) Open(name string) (file, error)        { return os.Open(name) }
 func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
 
+// LoadCredentials opens a dictionary file and returns its contents as a Credentials structure.
+func (s *Scanner) LoadCredentials() error {
+	s.term.Debugf("Loading credentials dictionary from path %q\n", s.credentialDictionaryPath)
+
+	// Open & Read JSON file.
+	content, err := ioutil.ReadFile(s.credentialDictionaryPath)
+	if err != nil {
+		return fmt.Errorf("could not read credentials dictionary file at %q: %v", s.credentialDictionaryPath, err)
+	}
+
+	// Unmarshal content of JSON file into data structure.
+	err = json.Unmarshal(content, &s.credentials)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal dictionary contents: %v", err)
+	}
+
+	s.term.Debugf("Loaded %d usernames, %d passwords and %d pairs\n", len(s.credentials.Usernames), len(s.credentials.Passwords), len(s.credentials.Pairs))
+	return nil
+}
+
 // LoadRoutes opens a dictionary file and returns its contents as a Routes structure.
+// Dictionaries with a .json, .yaml or .yml extension are loaded as structured
+// route dictionaries, and other files as lists of routes separated by newlines.
 func (s *Scanner) LoadRoutes() error {
 	s.term.Debugf("Loading routes dictionary from path %q\n", s.routeDictionaryPath)
 
+	switch strings.ToLower(filepath.Ext(s.routeDictionaryPath)) {
+	case ".json", ".yaml", ".yml":
+		return s.loadRouteDictionary()
+	}
+
 	file, err := os.Open(s.routeDictionaryPath)
 	if err != nil {
 		return fmt.Errorf("unable to open dictionary: %v", err)
@@ -50,6 +82,72 @@ func (s *Scanner) LoadRoutes() error {
 	return scanner.Err()
 }
 
+// loadRouteDictionary loads a structured route dictionary. The routes of every vendor
+// are also added to the generic routes, so that streams whose device model is unknown
+// are still attacked with them.
+func (s *Scanner) loadRouteDictionary() error {
+	content, err := ioutil.ReadFile(s.routeDictionaryPath)
+	if err != nil {
+		return fmt.Errorf("unable to open dictionary: %v", err)
+	}
+
+	// YAML being a superset of JSON, both formats are unmarshalled the same way.
+	var dictionary RouteDictionary
+	err = yaml.Unmarshal(content, &dictionary)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal dictionary contents: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	add := func(routes Routes) {
+		for _, route := range routes {
+			if seen[route] {
+				continue
+			}
+			seen[route] = true
+			s.routes = append(s.routes, route)
+		}
+	}
+
+	add(dictionary.Routes)
+
+	for _, vendor := range dictionary.Vendors {
+		products := vendor.Products
+		if len(products) == 0 {
+			products = []string{regexp.QuoteMeta(vendor.Vendor)}
+		}
+
+		compiled := vendorRoutes{
+			vendor: vendor.Vendor,
+			routes: vendor.Routes,
+		}
+		for _, product := range products {
+			pattern, err := regexp.Compile("(?i)" + product)
+			if err != nil {
+				return fmt.Errorf("invalid product pattern %q for vendor %q: %v", product, vendor.Vendor, err)
+			}
+			compiled.products = append(compiled.products, pattern)
+		}
+
+		s.vendorRoutes = append(s.vendorRoutes, compiled)
+		add(vendor.Routes)
+	}
+
+	s.term.Debugf("Loaded %d routes and %d vendors\n", len(s.routes), len(s.vendorRoutes))
+
+	return nil
+}
+
+// ParseCredentialsFromString parses a dictionary string and returns its contents as a Credentials structure.
+func ParseCredentialsFromString(content string) (Credentials, error) {
+	var creds Credentials
+	// Unmarshal content of JSON file into data structure.
+	err := json.Unmarshal([]byte(content), &creds)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return creds, nil
+}
 
 // ParseRoutesFromString parses a dictionary string and returns its contents as a Routes structure.
 func ParseRoutesFromString(content string) Routes {
@@ -240,6 +240,92 @@ func TestLoadRoutes(t *testing.T) {
 	}
 }
 
+func TestLoadRouteDictionary(t *testing.T) {
+	tests := []struct {
+		description string
+		extension   string
+		input       string
+
+		expectedRoutes  Routes
+		expectedVendors []string
+		expectedErr     bool
+	}{
+		{
+			description: "json dictionary",
+			extension:   ".json",
+			input:       `{"routes": ["live.sdp", "h264"], "vendors": [{"vendor": "Hikvision", "products": ["hikvision", "^DS-"], "routes": ["Streaming/Channels/101", "live.sdp"]}]}`,
+
+			expectedRoutes:  Routes{"live.sdp", "h264", "Streaming/Channels/101"},
+			expectedVendors: []string{"Hikvision"},
+		},
+		{
+			description: "yaml dictionary",
+			extension:   ".yml",
+			input: `
+routes:
+  - live.sdp
+vendors:
+  - vendor: Axis
+    routes:
+      - axis-media/media.amp
+  - vendor: Dahua
+    products: ["dahua", "amcrest"]
+    routes:
+      - cam/realmonitor
+`,
+
+			expectedRoutes:  Routes{"live.sdp", "axis-media/media.amp", "cam/realmonitor"},
+			expectedVendors: []string{"Axis", "Dahua"},
+		},
+		{
+			description: "invalid product pattern",
+			extension:   ".yaml",
+			input:       `{"vendors": [{"vendor": "Hikvision", "products": ["("]}]}`,
+
+			expectedErr: true,
+		},
+		{
+			description: "invalid dictionary",
+			extension:   ".json",
+			input:       `{"routes": "live.sdp"}`,
+
+			expectedErr: true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			filePath := "/tmp/cameradar_test_load_route_dictionary_" + fmt.Sprint(i) + test.extension
+
+			err := ioutil.WriteFile(filePath, []byte(test.input), 0644)
+			if err != nil {
+				t.Fatalf("could not write route dictionary: %v", err)
+			}
+			defer os.Remove(filePath)
+
+			scanner := &Scanner{
+				term:                disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				routeDictionaryPath: filePath,
+			}
+
+			err = scanner.LoadRoutes()
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedRoutes, scanner.routes)
+
+			var vendors []string
+			for _, vendor := range scanner.vendorRoutes {
+				vendors = append(vendors, vendor.vendor)
+			}
+			assert.Equal(t, test.expectedVendors, vendors)
+		})
+	}
+}
+
 func TestParseCredentialsFromString(t *testing.T) {
 	defaultCredentials := Credentials{
 		Usernames: []string{
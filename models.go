@@ -1,31 +1,170 @@
 package cameradar
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Stream represents a camera's RTSP stream
 type Stream struct {
-	Device   	string 			`json:"device"`
-	Username 	string 			`json:"username"`
-	Password 	string			`json:"password"`
-	ValidRoutes	[]ValidRoute	`json:"route"`
-	Address		string 			`json:"address" validate:"required"`
-	Port 	    uint16 			`json:"port" validate:"required"`
+	Device      string       `json:"device"`
+	Username    string       `json:"username"`
+	Password    string       `json:"password"`
+	ValidRoutes []ValidRoute `json:"route"`
+	Address     string       `json:"address" validate:"required"`
+	Port        uint16       `json:"port" validate:"required"`
 
-	// Auth type set for the whole host and not for each Route. This should be always true most of the times. 
-	// Having this set for the whole device should reduce scanning times 
-	AuthenticationType int 		`json:"authentication_type"`
+	// MACAddress is the MAC address of the camera, which is only known when it is
+	// on the local network, and HardwareVendor is the manufacturer it was assigned to.
+	MACAddress     string `json:"mac_address,omitempty"`
+	HardwareVendor string `json:"hardware_vendor,omitempty"`
+
+	// AuthenticationType is the authentication method of the first route of the stream,
+	// and Username and Password are the credentials of its first accessible route. Each
+	// route also has its own, since the main stream and sub-streams of some encoders
+	// use different accounts or authentication methods. The authentication method is
+	// unknown when it could not be detected, in which case it is left out of the JSON
+	// output, whose authentication_method tells it by name.
+	AuthenticationType int `json:"authentication_type"`
+
+	// CredentialsFound is whether the credentials of the stream were found, which
+	// can be empty when the stream accepts them.
+	CredentialsFound bool `json:"credentials_found"`
+
+	// AuthenticationSchemes are all the authentication schemes offered by the stream,
+	// among which the strongest supported one is its authentication method.
+	AuthenticationSchemes []AuthenticationScheme `json:"authentication_schemes,omitempty"`
+
+	// RouteBehavior is how the stream answers requests on routes that do not exist,
+	// which decides how its routes are attacked.
+	RouteBehavior RouteBehavior `json:"route_behavior"`
+
+	// TLS is whether the stream is served over TLS (RTSPS), in which case
+	// Certificate describes the certificate presented by the camera.
+	TLS         bool         `json:"tls"`
+	Certificate *Certificate `json:"certificate,omitempty"`
+
+	// HTTPTunnel is whether the stream is reached by tunneling RTSP in HTTP.
+	HTTPTunnel bool `json:"http_tunnel"`
+
+	// XAddrs are the addresses of the ONVIF device service of the camera, and Scopes
+	// are the ONVIF scopes it announced, when it was found using WS-Discovery.
+	XAddrs []string `json:"xaddrs,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+
+	// ONVIF describes the ONVIF device service of the camera, when it could be accessed.
+	ONVIF *ONVIFDevice `json:"onvif,omitempty"`
+}
+
+// ONVIFDevice describes the ONVIF device service of a camera, and the credentials
+// with which it was accessed. Its device information and capabilities are only
+// retrieved when the ONVIF inventory is enabled.
+type ONVIFDevice struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	Manufacturer    string `json:"manufacturer,omitempty"`
+	Model           string `json:"model,omitempty"`
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	HardwareID      string `json:"hardware_id,omitempty"`
+
+	// PTZ, Audio, Analytics and Backchannel are whether the camera can be moved,
+	// records audio, runs video analytics and can play audio sent to it.
+	PTZ         bool `json:"ptz"`
+	Audio       bool `json:"audio"`
+	Analytics   bool `json:"analytics"`
+	Backchannel bool `json:"backchannel"`
+
+	// Services are the namespaces of the ONVIF services of the camera.
+	Services []string `json:"services,omitempty"`
+}
+
+// AuthenticationScheme is an authentication scheme offered by a stream in a
+// WWW-Authenticate header, along with the realm it protects.
+type AuthenticationScheme struct {
+	Scheme string `json:"scheme"`
+	Realm  string `json:"realm,omitempty"`
+}
+
+// Certificate describes the TLS certificate of a stream.
+type Certificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
 }
 
+// Credentials is a credentials dictionary. Every username is tried with every
+// password, and pairs contains explicit "username:password" combinations which
+// are tried before them.
+type Credentials struct {
+	Usernames []string `json:"usernames"`
+	Passwords []string `json:"passwords"`
+	Pairs     []string `json:"pairs"`
+}
 
 // Routes is a slice of Routes
 // ['/live.sdp', '/media.amp', ...]
 type Routes []string
 
+// RouteDictionary is a structured routes dictionary, in which routes can be
+// associated with the products of a vendor. Routes of vendors whose products
+// match the device model of a stream are attacked first on that stream.
+type RouteDictionary struct {
+	Vendors []VendorRoutes `json:"vendors" yaml:"vendors"`
+	Routes  Routes         `json:"routes" yaml:"routes"`
+}
+
+// VendorRoutes are the routes used by the products of a vendor. Products are
+// case-insensitive regular expressions matched against the device model found
+// by nmap. When no products are given, the vendor name is matched instead. Streams
+// whose hardware vendor contains the vendor name also match, whatever their model.
+type VendorRoutes struct {
+	Vendor   string   `json:"vendor" yaml:"vendor"`
+	Products []string `json:"products" yaml:"products"`
+	Routes   Routes   `json:"routes" yaml:"routes"`
+}
+
 type ValidRoute struct {
-	Route				string 	`json:"routes"`
-	Available			bool 	`json:"available"`
-	CredentialsFound 	bool 	`json:"credentialsFound"`
-	ImageURL			string	`json:"imageUrl"`
+	Route            string `json:"routes"`
+	Available        bool   `json:"available"`
+	CredentialsFound bool   `json:"credentialsFound"`
+	ImageURL         string `json:"imageUrl"`
+
+	// Username and Password are the credentials giving access to the route, and
+	// AuthenticationType is the authentication method the route requires, which is
+	// written like the one of streams in the JSON output.
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	AuthenticationType int    `json:"authenticationType"`
+
+	// AuthenticationSchemes are all the authentication schemes offered by the route.
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes,omitempty"`
+
+	// Tracks are the media tracks of the route, as described by its SDP.
+	Tracks []Track `json:"tracks,omitempty"`
+
+	// StreamType tells whether the route is the main stream of the camera or one
+	// of its sub-streams, based on the resolution of its video tracks.
+	StreamType string `json:"streamType,omitempty"`
+
+	// Transport is the RTP transport with which the route could be set up, or
+	// with which it was played if playback validation is enabled.
+	Transport string `json:"transport,omitempty"`
+
+	// PacketsReceived and FirstPacketLatency describe the RTP packets received
+	// when playing the route, if playback validation is enabled.
+	PacketsReceived    int           `json:"packetsReceived,omitempty"`
+	FirstPacketLatency time.Duration `json:"firstPacketLatency,omitempty"`
+
+	// Channel is the NVR channel of the route, if it follows a known channel pattern.
+	Channel int `json:"channel,omitempty"`
+
+	// ONVIF is whether the route was retrieved from the camera through ONVIF
+	// rather than found using the route dictionary.
+	ONVIF bool `json:"onvif,omitempty"`
 }
 
 // Options contains all options needed to launch a complete cameradar scan
@@ -33,8 +172,33 @@ type Options struct {
 	Targets     []string      `json:"target" validate:"required"`
 	Ports       []string      `json:"ports"`
 	Routes      Routes        `json:"routes"`
+	Credentials Credentials   `json:"credentials"`
 	Speed       int           `json:"speed"`
 	Timeout     time.Duration `json:"timeout"`
-	Password	string        `json:"password"` 
-	Username	string        `json:"username"` 
+	Password    string        `json:"password"`
+	Username    string        `json:"username"`
+}
+
+// MarshalJSON writes the stream with its authentication method by name, and with its
+// authentication type only when it was detected.
+func (s Stream) MarshalJSON() ([]byte, error) {
+	type stream Stream
+	method, authType := authMethodJSON(s.AuthenticationType)
+	return json.Marshal(struct {
+		stream
+		AuthenticationType   *int   `json:"authentication_type,omitempty"`
+		AuthenticationMethod string `json:"authentication_method"`
+	}{stream(s), authType, method})
+}
+
+// MarshalJSON writes the route with its authentication method by name, and with its
+// authentication type only when it was detected.
+func (r ValidRoute) MarshalJSON() ([]byte, error) {
+	type validRoute ValidRoute
+	method, authType := authMethodJSON(r.AuthenticationType)
+	return json.Marshal(struct {
+		validRoute
+		AuthenticationType   *int   `json:"authenticationType,omitempty"`
+		AuthenticationMethod string `json:"authenticationMethod"`
+	}{validRoute(r), authType, method})
 }
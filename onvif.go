@@ -0,0 +1,446 @@
+package cameradar
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// onvifDevicePath is the path of the ONVIF device service of most cameras, which
+// is used for cameras that did not announce it using WS-Discovery.
+const onvifDevicePath = "/onvif/device_service"
+
+// onvifEnvelope is a SOAP 1.2 envelope, formatted with its header and body.
+const onvifEnvelope = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<s:Header>%s</s:Header>
+<s:Body>%s</s:Body>
+</s:Envelope>`
+
+// onvifSecurity is a WS-Security header holding a UsernameToken with a password
+// digest, formatted with the username, the digest, the nonce and the creation time.
+const onvifSecurity = `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+<UsernameToken>
+<Username>%s</Username>
+<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%s</Password>
+<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-soap-message-security-1.0#Base64Binary">%s</Nonce>
+<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%s</Created>
+</UsernameToken>
+</Security>`
+
+// ONVIF requests.
+const (
+	onvifGetSystemDateAndTime = `<tds:GetSystemDateAndTime/>`
+	onvifGetCapabilities      = `<tds:GetCapabilities><tds:Category>All</tds:Category></tds:GetCapabilities>`
+	onvifGetProfiles          = `<trt:GetProfiles/>`
+	onvifGetStreamURI         = `<trt:GetStreamUri><trt:StreamSetup><tt:Stream>RTP-Unicast</tt:Stream><tt:Transport><tt:Protocol>RTSP</tt:Protocol></tt:Transport></trt:StreamSetup><trt:ProfileToken>%s</trt:ProfileToken></trt:GetStreamUri>`
+)
+
+// errONVIFUnauthorized is returned by ONVIF requests rejected because of their credentials.
+var errONVIFUnauthorized = errors.New("not authorized")
+
+type soapEnvelope struct {
+	Body soapBody `xml:"Body"`
+}
+
+type soapBody struct {
+	Fault   *soapFault `xml:"Fault"`
+	Content []byte     `xml:",innerxml"`
+}
+
+type soapFault struct {
+	Subcode string `xml:"Code>Subcode>Value"`
+	Reason  string `xml:"Reason>Text"`
+}
+
+type systemDateAndTimeResponse struct {
+	UTC struct {
+		Year   int `xml:"Date>Year"`
+		Month  int `xml:"Date>Month"`
+		Day    int `xml:"Date>Day"`
+		Hour   int `xml:"Time>Hour"`
+		Minute int `xml:"Time>Minute"`
+		Second int `xml:"Time>Second"`
+	} `xml:"SystemDateAndTime>UTCDateTime"`
+}
+
+type capabilitiesResponse struct {
+	MediaXAddr     string `xml:"Capabilities>Media>XAddr"`
+	PTZXAddr       string `xml:"Capabilities>PTZ>XAddr"`
+	AnalyticsXAddr string `xml:"Capabilities>Analytics>XAddr"`
+	AudioSources   int    `xml:"Capabilities>Extension>DeviceIO>AudioSources"`
+	AudioOutputs   int    `xml:"Capabilities>Extension>DeviceIO>AudioOutputs"`
+}
+
+type profilesResponse struct {
+	Profiles []struct {
+		Token string `xml:"token,attr"`
+	} `xml:"Profiles"`
+}
+
+type streamURIResponse struct {
+	URI string `xml:"MediaUri>Uri"`
+}
+
+// onvifClient sends requests to the web services of an ONVIF camera.
+type onvifClient struct {
+	http *http.Client
+
+	// offset is the difference between the clock of the camera and ours, since
+	// UsernameTokens are only accepted when they were created recently.
+	offset time.Duration
+}
+
+// newONVIFClient returns a client with which to send requests to a single camera.
+// It must be closed once the camera is done with.
+func (s *Scanner) newONVIFClient() *onvifClient {
+	return &onvifClient{
+		http: &http.Client{
+			Timeout: s.timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: s.tlsInsecure},
+			},
+		},
+	}
+}
+
+// close closes the connections kept alive by the client.
+func (c *onvifClient) close() {
+	c.http.CloseIdleConnections()
+}
+
+// RetrieveONVIFRoutes asks the ONVIF cameras among the targets for the URIs of their
+// streams, trying the credentials of the dictionary until one is accepted. The routes
+// of these URIs are added to the valid routes of the targets, and the targets whose
+// routes were retrieved this way are not attacked with the route dictionary.
+func (s *Scanner) RetrieveONVIFRoutes(targets []Stream) []Stream {
+	return s.RetrieveONVIFRoutesContext(context.Background(), targets)
+}
+
+// RetrieveONVIFRoutesContext is like RetrieveONVIFRoutes, but stops sending
+// requests once the given context is done.
+func (s *Scanner) RetrieveONVIFRoutesContext(ctx context.Context, targets []Stream) []Stream {
+	return s.attackStreams(targets, func(target Stream) Stream {
+		return s.retrieveCameraONVIFRoutes(ctx, target)
+	})
+}
+
+func (s *Scanner) retrieveCameraONVIFRoutes(ctx context.Context, target Stream) Stream {
+	client := s.newONVIFClient()
+	defer client.close()
+
+	deviceURL := s.onvifDeviceService(ctx, target, client)
+	if deviceURL == "" {
+		s.term.Debugf("Stream %s has no ONVIF device service\n", GetCameraRTSPURL(target))
+		return target
+	}
+
+	// ONVIF services can usually be used anonymously when no user was created.
+	candidates := append([]credentialPair{{}}, s.credentialPairs()...)
+
+	uris := make([][]string, len(candidates))
+	c, err := s.onvifLogin(ctx, target, len(candidates), func(c int) error {
+		var err error
+		uris[c], err = client.streamURIs(ctx, deviceURL, candidates[c])
+		return err
+	})
+	switch {
+	case err == errONVIFUnauthorized:
+		s.term.Debugf("No credentials were accepted by %s\n", deviceURL)
+		return target
+	case err != nil:
+		if ctx.Err() == nil {
+			s.term.Errorf("Unable to retrieve stream URIs of %s: %v\n", deviceURL, err)
+		}
+		return target
+	}
+
+	s.term.Debugf("Retrieved %d stream URIs of %s as %q\n", len(uris[c]), deviceURL, candidates[c].username)
+
+	target.ONVIF = &ONVIFDevice{
+		URL:      deviceURL,
+		Username: candidates[c].username,
+		Password: candidates[c].password,
+	}
+
+	return addONVIFRoutes(target, uris[c])
+}
+
+// onvifDeviceService returns the URL of the device service of the camera of the
+// given stream, or an empty string if it has none.
+func (s *Scanner) onvifDeviceService(ctx context.Context, target Stream, client *onvifClient) string {
+	urls := onvifDeviceURLs(target)
+	if target.ONVIF != nil {
+		urls = []string{target.ONVIF.URL}
+	}
+
+	var deviceURL string
+	s.attemptAll(ctx, target, 1, func(int) bool {
+		deviceURL = client.findDeviceService(ctx, urls)
+		return true
+	})
+
+	return deviceURL
+}
+
+// onvifLogin calls attempt with each of the n candidate credentials until one is
+// accepted, and returns its index. Candidates which fail for another reason than
+// their credentials do not stop the login, unless the camera can not be reached
+// anymore. When no candidate was accepted, the index and error of the first one
+// which failed for another reason are returned, or errONVIFUnauthorized if every
+// candidate was rejected.
+func (s *Scanner) onvifLogin(ctx context.Context, target Stream, n int, attempt func(c int) error) (int, error) {
+	// Candidates which were not tried, because another one was accepted first
+	// or the context is done, are considered rejected.
+	errs := make([]error, n)
+	for c := range errs {
+		errs[c] = errONVIFUnauthorized
+	}
+
+	s.attemptAll(ctx, target, n, func(c int) bool {
+		errs[c] = attempt(c)
+		return errs[c] == nil || isUnreachable(errs[c])
+	})
+
+	for c, err := range errs {
+		if err == nil {
+			return c, nil
+		}
+	}
+
+	for c, err := range errs {
+		if err != errONVIFUnauthorized {
+			return c, err
+		}
+	}
+
+	return -1, errONVIFUnauthorized
+}
+
+// isUnreachable returns whether the given error of an ONVIF request means that
+// the camera could not be connected to, in which case retrying is pointless.
+func isUnreachable(err error) bool {
+	urlErr, ok := err.(*url.Error)
+	if !ok {
+		return false
+	}
+
+	opErr, ok := urlErr.Err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// onvifDeviceURLs returns the URLs on which the device service of the camera of the
+// given stream might be found.
+func onvifDeviceURLs(target Stream) []string {
+	urls := append([]string{}, target.XAddrs...)
+	return append(urls, "http://"+urlHost(target.Address)+":80"+onvifDevicePath)
+}
+
+// addONVIFRoutes adds the routes of the given stream URIs to the valid routes of the
+// stream. Only the URIs of the port of the stream are kept, unless the stream was found
+// using WS-Discovery, in which case its port was only assumed.
+func addONVIFRoutes(target Stream, uris []string) Stream {
+	seen := make(map[string]bool)
+	for _, route := range target.ValidRoutes {
+		seen[route.Route] = true
+	}
+
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || !strings.HasPrefix(u.Scheme, "rtsp") {
+			continue
+		}
+
+		port := onvifRTSPPort
+		if u.Port() != "" {
+			p, err := strconv.ParseUint(u.Port(), 10, 16)
+			if err != nil {
+				continue
+			}
+			port = uint16(p)
+		}
+
+		if port != target.Port {
+			if len(target.XAddrs) == 0 || hasONVIFRoutes(target) {
+				continue
+			}
+			target.Port = port
+		}
+
+		route := strings.TrimPrefix(u.EscapedPath(), "/")
+		if u.RawQuery != "" {
+			route += "?" + u.RawQuery
+		}
+
+		if seen[route] {
+			continue
+		}
+		seen[route] = true
+
+		target.ValidRoutes = append(target.ValidRoutes, ValidRoute{Route: route, ONVIF: true})
+	}
+
+	return target
+}
+
+// hasONVIFRoutes returns whether routes of the stream were retrieved through ONVIF.
+func hasONVIFRoutes(target Stream) bool {
+	for _, route := range target.ValidRoutes {
+		if route.ONVIF {
+			return true
+		}
+	}
+	return false
+}
+
+// findDeviceService returns the first of the given URLs on which an ONVIF device
+// service answers, and synchronizes the clock of the client with it.
+func (c *onvifClient) findDeviceService(ctx context.Context, urls []string) string {
+	for _, deviceURL := range urls {
+		var res systemDateAndTimeResponse
+		err := c.call(ctx, deviceURL, credentialPair{}, onvifGetSystemDateAndTime, &res)
+		if ctx.Err() != nil {
+			return ""
+		}
+		if err != nil {
+			continue
+		}
+
+		utc := res.UTC
+		if utc.Year > 0 {
+			now := time.Date(utc.Year, time.Month(utc.Month), utc.Day, utc.Hour, utc.Minute, utc.Second, 0, time.UTC)
+			c.offset = time.Until(now)
+		}
+
+		return deviceURL
+	}
+
+	return ""
+}
+
+// streamURIs returns the stream URIs of each media profile of the camera.
+func (c *onvifClient) streamURIs(ctx context.Context, deviceURL string, credentials credentialPair) ([]string, error) {
+	var capabilities capabilitiesResponse
+	err := c.call(ctx, deviceURL, credentials, onvifGetCapabilities, &capabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaURL := strings.TrimSpace(capabilities.MediaXAddr)
+	if mediaURL == "" {
+		return nil, errors.New("no media service")
+	}
+
+	var profiles profilesResponse
+	err = c.call(ctx, mediaURL, credentials, onvifGetProfiles, &profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var uris []string
+	for _, profile := range profiles.Profiles {
+		var res streamURIResponse
+		err = c.call(ctx, mediaURL, credentials, fmt.Sprintf(onvifGetStreamURI, xmlEscape(profile.Token)), &res)
+		if err != nil {
+			return nil, err
+		}
+
+		if uri := strings.TrimSpace(res.URI); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+
+	return uris, nil
+}
+
+// call sends the given request to the service at the given URL, and decodes its
+// response. Requests are authenticated with a UsernameToken when a username is given.
+func (c *onvifClient) call(ctx context.Context, serviceURL string, credentials credentialPair, request string, response interface{}) error {
+	var header string
+	if credentials.username != "" {
+		header = c.usernameToken(credentials)
+	}
+
+	body := fmt.Sprintf(onvifEnvelope, header, request)
+	req, err := http.NewRequest(http.MethodPost, serviceURL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+	req.Header.Set("User-Agent", rtspUserAgent)
+
+	res, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return errONVIFUnauthorized
+	}
+
+	var envelope soapEnvelope
+	err = xml.Unmarshal(content, &envelope)
+	if err != nil {
+		return fmt.Errorf("invalid response with status %q: %v", res.Status, err)
+	}
+
+	if fault := envelope.Body.Fault; fault != nil {
+		if strings.HasSuffix(fault.Subcode, "NotAuthorized") {
+			return errONVIFUnauthorized
+		}
+		return fmt.Errorf("SOAP fault %q: %s", fault.Subcode, strings.TrimSpace(fault.Reason))
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %q", res.Status)
+	}
+
+	return xml.Unmarshal(envelope.Body.Content, response)
+}
+
+// usernameToken returns a WS-Security header authenticating the given credentials
+// with a password digest, which is the SHA-1 of a nonce, the creation time and
+// the password.
+func (c *onvifClient) usernameToken(credentials credentialPair) string {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+
+	created := time.Now().Add(c.offset).UTC().Format("2006-01-02T15:04:05Z")
+
+	digest := sha1.New()
+	digest.Write(nonce)
+	digest.Write([]byte(created))
+	digest.Write([]byte(credentials.password))
+
+	return fmt.Sprintf(onvifSecurity,
+		xmlEscape(credentials.username),
+		base64.StdEncoding.EncodeToString(digest.Sum(nil)),
+		base64.StdEncoding.EncodeToString(nonce),
+		created,
+	)
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
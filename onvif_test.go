@@ -0,0 +1,386 @@
+package cameradar
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeSOAPResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body>%s</env:Body>
+</env:Envelope>`
+
+const fakeSOAPNotAuthorized = `<env:Fault>
+<env:Code><env:Value>env:Sender</env:Value><env:Subcode><env:Value>ter:NotAuthorized</env:Value></env:Subcode></env:Code>
+<env:Reason><env:Text xml:lang="en">Sender not Authorized</env:Text></env:Reason>
+</env:Fault>`
+
+var usernameTokenRegexp = regexp.MustCompile(`(?s)<Username>(.*)</Username>.*<Password[^>]*>(.*)</Password>.*<Nonce[^>]*>(.*)</Nonce>.*<Created[^>]*>(.*)</Created>`)
+
+// fakeONVIFCamera is a stand-in for the web services of an ONVIF camera, whose
+// clock is an hour ahead. An empty username allows anonymous access.
+type fakeONVIFCamera struct {
+	username string
+	password string
+	uris     []string
+
+	// legacy cameras do not support GetServices.
+	legacy bool
+}
+
+func (c fakeONVIFCamera) serve(t *testing.T) *httptest.Server {
+	clock := time.Now().Add(time.Hour).UTC()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request := string(body)
+
+		respond := func(content string) {
+			w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+			fmt.Fprintf(w, fakeSOAPResponse, content)
+		}
+
+		if strings.Contains(request, "GetSystemDateAndTime") {
+			respond(fmt.Sprintf(`<tds:GetSystemDateAndTimeResponse><tds:SystemDateAndTime><tt:DateTimeType>NTP</tt:DateTimeType><tt:UTCDateTime><tt:Time><tt:Hour>%d</tt:Hour><tt:Minute>%d</tt:Minute><tt:Second>%d</tt:Second></tt:Time><tt:Date><tt:Year>%d</tt:Year><tt:Month>%d</tt:Month><tt:Day>%d</tt:Day></tt:Date></tt:UTCDateTime></tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse>`,
+				clock.Hour(), clock.Minute(), clock.Second(), clock.Year(), clock.Month(), clock.Day()))
+			return
+		}
+
+		if !c.authorized(request, clock) {
+			w.WriteHeader(http.StatusBadRequest)
+			respond(fakeSOAPNotAuthorized)
+			return
+		}
+
+		switch {
+		case strings.Contains(request, "GetCapabilities"):
+			respond(fmt.Sprintf(`<tds:GetCapabilitiesResponse><tds:Capabilities><tt:Media><tt:XAddr>%[1]s/onvif/media_service</tt:XAddr></tt:Media><tt:PTZ><tt:XAddr>%[1]s/onvif/ptz_service</tt:XAddr></tt:PTZ><tt:Extension><tt:DeviceIO><tt:XAddr>%[1]s/onvif/deviceio_service</tt:XAddr><tt:VideoSources>1</tt:VideoSources><tt:AudioSources>1</tt:AudioSources><tt:AudioOutputs>1</tt:AudioOutputs></tt:DeviceIO></tt:Extension></tds:Capabilities></tds:GetCapabilitiesResponse>`, server.URL))
+		case strings.Contains(request, "GetDeviceInformation"):
+			respond(`<tds:GetDeviceInformationResponse><tds:Manufacturer>HIKVISION</tds:Manufacturer><tds:Model>DS-2CD2032-I</tds:Model><tds:FirmwareVersion>V5.4.5 build 170124</tds:FirmwareVersion><tds:SerialNumber>DS-2CD2032-I20170301AAWR123456789</tds:SerialNumber><tds:HardwareId>88</tds:HardwareId></tds:GetDeviceInformationResponse>`)
+		case strings.Contains(request, "GetServices") && !c.legacy:
+			respond(fmt.Sprintf(`<tds:GetServicesResponse><tds:Service><tds:Namespace>http://www.onvif.org/ver10/device/wsdl</tds:Namespace><tds:XAddr>%[1]s/onvif/device_service</tds:XAddr></tds:Service><tds:Service><tds:Namespace>http://www.onvif.org/ver20/analytics/wsdl</tds:Namespace><tds:XAddr>%[1]s/onvif/analytics_service</tds:XAddr></tds:Service></tds:GetServicesResponse>`, server.URL))
+		case strings.Contains(request, "GetProfiles"):
+			var profiles string
+			for i := range c.uris {
+				profiles += fmt.Sprintf(`<trt:Profiles token="Profile_%d" fixed="true"><tt:Name>Profile %d</tt:Name></trt:Profiles>`, i, i)
+			}
+			respond("<trt:GetProfilesResponse>" + profiles + "</trt:GetProfilesResponse>")
+		case strings.Contains(request, "GetStreamUri"):
+			var uri string
+			for i := range c.uris {
+				if strings.Contains(request, fmt.Sprintf("<trt:ProfileToken>Profile_%d</trt:ProfileToken>", i)) {
+					uri = c.uris[i]
+				}
+			}
+			respond(fmt.Sprintf(`<trt:GetStreamUriResponse><trt:MediaUri><tt:Uri>%s</tt:Uri><tt:Timeout>PT0S</tt:Timeout></trt:MediaUri></trt:GetStreamUriResponse>`, xmlEscape(uri)))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+
+	return server
+}
+
+// authorized returns whether the request holds a valid UsernameToken which was
+// created recently according to the given clock.
+func (c fakeONVIFCamera) authorized(request string, clock time.Time) bool {
+	if c.username == "" {
+		return true
+	}
+
+	token := usernameTokenRegexp.FindStringSubmatch(request)
+	if token == nil || token[1] != c.username {
+		return false
+	}
+
+	created, err := time.Parse(time.RFC3339, token[4])
+	if err != nil || created.Sub(clock) > 5*time.Second || clock.Sub(created) > 5*time.Second {
+		return false
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(token[3])
+	if err != nil {
+		return false
+	}
+
+	digest := sha1.New()
+	digest.Write(nonce)
+	digest.Write([]byte(token[4]))
+	digest.Write([]byte(c.password))
+
+	return token[2] == base64.StdEncoding.EncodeToString(digest.Sum(nil))
+}
+
+func TestRetrieveONVIFRoutes(t *testing.T) {
+	tests := []struct {
+		description string
+
+		camera      *fakeONVIFCamera
+		credentials Credentials
+
+		expectedRoutes []ValidRoute
+	}{
+		{
+			description: "routes retrieved with credentials of the dictionary",
+
+			camera: &fakeONVIFCamera{
+				username: "admin",
+				password: "12345",
+				uris: []string{
+					"rtsp://172.16.100.10:554/Streaming/Channels/101?transportmode=unicast&profile=Profile_1",
+					"rtsp://172.16.100.10/Streaming/Channels/102",
+					"rtsp://172.16.100.10:8554/other",
+				},
+			},
+			credentials: Credentials{
+				Usernames: []string{"admin", "root"},
+				Passwords: []string{"admin", "12345"},
+			},
+
+			expectedRoutes: []ValidRoute{
+				{Route: "Streaming/Channels/101?transportmode=unicast&profile=Profile_1", ONVIF: true},
+				{Route: "Streaming/Channels/102", ONVIF: true},
+			},
+		},
+		{
+			description: "routes retrieved anonymously",
+
+			camera: &fakeONVIFCamera{
+				uris: []string{"rtsp://172.16.100.10/live.sdp"},
+			},
+
+			expectedRoutes: []ValidRoute{
+				{Route: "live.sdp", ONVIF: true},
+			},
+		},
+		{
+			description: "no credentials accepted",
+
+			camera: &fakeONVIFCamera{
+				username: "admin",
+				password: "secret",
+				uris:     []string{"rtsp://172.16.100.10/live.sdp"},
+			},
+			credentials: Credentials{
+				Usernames: []string{"admin"},
+				Passwords: []string{"12345"},
+			},
+		},
+		{
+			description: "not an ONVIF camera",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			target := Stream{Address: "127.0.0.1", Port: 554}
+			if test.camera != nil {
+				server := test.camera.serve(t)
+				defer server.Close()
+
+				target.XAddrs = []string{server.URL + onvifDevicePath}
+			} else {
+				server := httptest.NewServer(http.NotFoundHandler())
+				defer server.Close()
+
+				target.XAddrs = []string{server.URL + onvifDevicePath}
+			}
+
+			scanner := &Scanner{
+				term:        disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				timeout:     time.Second,
+				credentials: test.credentials,
+			}
+
+			results := scanner.RetrieveONVIFRoutes([]Stream{target})
+
+			if assert.Len(t, results, 1) {
+				assert.Equal(t, test.expectedRoutes, results[0].ValidRoutes)
+			}
+		})
+	}
+}
+
+func TestONVIFLogin(t *testing.T) {
+	unreachable := &url.Error{Op: "Post", URL: "http://127.0.0.1/onvif/device_service", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	serverError := errors.New(`unexpected status "500 Internal Server Error"`)
+
+	tests := []struct {
+		description string
+
+		errs []error
+
+		expectedIndex    int
+		expectedErr      error
+		expectedAttempts int
+	}{
+		{
+			description: "credentials accepted",
+
+			errs: []error{errONVIFUnauthorized, nil, errONVIFUnauthorized},
+
+			expectedIndex:    1,
+			expectedAttempts: 2,
+		},
+		{
+			description: "credentials accepted after a server error",
+
+			errs: []error{serverError, errONVIFUnauthorized, nil},
+
+			expectedIndex:    2,
+			expectedAttempts: 3,
+		},
+		{
+			description: "every credentials rejected",
+
+			errs: []error{errONVIFUnauthorized, errONVIFUnauthorized},
+
+			expectedIndex:    -1,
+			expectedErr:      errONVIFUnauthorized,
+			expectedAttempts: 2,
+		},
+		{
+			description: "server errors only",
+
+			errs: []error{errONVIFUnauthorized, serverError, serverError},
+
+			expectedIndex:    1,
+			expectedErr:      serverError,
+			expectedAttempts: 3,
+		},
+		{
+			description: "camera unreachable",
+
+			errs: []error{errONVIFUnauthorized, unreachable, nil},
+
+			expectedIndex:    1,
+			expectedErr:      unreachable,
+			expectedAttempts: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scanner := &Scanner{
+				term: disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+			}
+
+			attempts := 0
+			c, err := scanner.onvifLogin(context.Background(), Stream{Address: "127.0.0.1"}, len(test.errs), func(c int) error {
+				attempts++
+				return test.errs[c]
+			})
+
+			assert.Equal(t, test.expectedIndex, c)
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expectedAttempts, attempts)
+		})
+	}
+}
+
+func TestAddONVIFRoutes(t *testing.T) {
+	tests := []struct {
+		description string
+
+		target Stream
+		uris   []string
+
+		expectedPort   uint16
+		expectedRoutes []ValidRoute
+	}{
+		{
+			description: "routes of other ports are ignored",
+
+			target: Stream{Port: 8554},
+			uris:   []string{"rtsp://172.16.100.10/main", "rtsp://172.16.100.10:8554/sub", "http://172.16.100.10:8554/snapshot.jpg"},
+
+			expectedPort:   8554,
+			expectedRoutes: []ValidRoute{{Route: "sub", ONVIF: true}},
+		},
+		{
+			description: "discovered streams use the port of their routes",
+
+			target: Stream{Port: 554, XAddrs: []string{"http://172.16.100.10/onvif/device_service"}},
+			uris:   []string{"rtsp://172.16.100.10:8554/main", "rtsp://172.16.100.10:8554/sub", "rtsp://172.16.100.10/other"},
+
+			expectedPort:   8554,
+			expectedRoutes: []ValidRoute{{Route: "main", ONVIF: true}, {Route: "sub", ONVIF: true}},
+		},
+		{
+			description: "known routes are not duplicated",
+
+			target: Stream{Port: 554, ValidRoutes: []ValidRoute{{Route: "main"}}},
+			uris:   []string{"rtsp://172.16.100.10/main", "rtsp://172.16.100.10/main?profile=2"},
+
+			expectedPort:   554,
+			expectedRoutes: []ValidRoute{{Route: "main"}, {Route: "main?profile=2", ONVIF: true}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			result := addONVIFRoutes(test.target, test.uris)
+
+			assert.Equal(t, test.expectedPort, result.Port)
+			assert.Equal(t, test.expectedRoutes, result.ValidRoutes)
+		})
+	}
+}
+
+func TestAttackONVIF(t *testing.T) {
+	rtsp := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		if strings.HasSuffix(req.uri, "/Streaming/Channels/101") {
+			return fakeOK
+		}
+		return fakeNotFound
+	})
+	defer rtsp.close()
+
+	target := rtsp.stream(t)
+
+	camera := fakeONVIFCamera{
+		username: "admin",
+		password: "12345",
+		uris:     []string{fmt.Sprintf("rtsp://%s:%d/Streaming/Channels/101", target.Address, target.Port)},
+	}
+	server := camera.serve(t)
+	defer server.Close()
+
+	target.XAddrs = []string{server.URL + onvifDevicePath}
+
+	scanner := &Scanner{
+		term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		curl:    NewRTSPClient(),
+		timeout: time.Second,
+		onvif:   true,
+		routes:  Routes{"live.sdp"},
+		credentials: Credentials{
+			Usernames: []string{"admin"},
+			Passwords: []string{"12345"},
+		},
+	}
+
+	results, err := scanner.AttackContext(context.Background(), []Stream{target})
+
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, []ValidRoute{{Route: "Streaming/Channels/101", ONVIF: true, CredentialsFound: true, Available: true, Transport: TransportTCP, Channel: 1}}, results[0].ValidRoutes)
+		assert.Equal(t, &ONVIFDevice{URL: server.URL + onvifDevicePath, Username: "admin", Password: "12345"}, results[0].ONVIF)
+	}
+}
@@ -0,0 +1,71 @@
+package cameradar
+
+import (
+	"bufio"
+	"strings"
+	"sync"
+)
+
+// The MAC address prefixes of dictionaries/mac-prefixes are built into cameradar,
+// to find the vendor of hosts whose vendor nmap does not know.
+//go:generate go run ./tools/mac_prefixes_generator
+
+var (
+	ouiOnce    sync.Once
+	ouiVendors map[string]string
+)
+
+// parseMACPrefixes parses a list of MAC address prefixes in the format of nmap's
+// nmap-mac-prefixes file, in which each line is a hexadecimal prefix followed by
+// the name of its vendor, and returns the vendors indexed by their prefix.
+func parseMACPrefixes(content string) map[string]string {
+	vendors := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || !isHex(fields[0]) {
+			continue
+		}
+
+		vendors[strings.ToUpper(fields[0])] = strings.TrimSpace(fields[1])
+	}
+
+	return vendors
+}
+
+// lookupVendor returns the name of the manufacturer to which the given MAC address
+// was assigned, or an empty string if it is unknown. The longest matching prefix
+// is used, since large blocks can contain smaller ones assigned to other vendors.
+func lookupVendor(mac string) string {
+	ouiOnce.Do(func() {
+		ouiVendors = parseMACPrefixes(macPrefixes)
+	})
+
+	digits := strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.TrimSpace(mac)))
+	if len(digits) < 6 || !isHex(digits) {
+		return ""
+	}
+
+	for length := len(digits); length >= 6; length-- {
+		if vendor, ok := ouiVendors[digits[:length]]; ok {
+			return vendor
+		}
+	}
+
+	return ""
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return s != ""
+}
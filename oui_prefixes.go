@@ -0,0 +1,69 @@
+// Code generated by tools/mac_prefixes_generator from dictionaries/mac-prefixes. DO NOT EDIT.
+
+package cameradar
+
+// macPrefixes lists the MAC address prefixes assigned to camera and NVR manufacturers,
+// in the format of nmap's nmap-mac-prefixes file.
+const macPrefixes = `# MAC address prefixes of camera and NVR manufacturers, in the format of nmap's
+# nmap-mac-prefixes file: a hexadecimal prefix followed by the name of the
+# organization it was assigned to by the IEEE. Lines starting with # are ignored.
+# The full nmap-mac-prefixes file, or any file following its format, can be used
+# in its place.
+
+# Hikvision
+1868CB Hangzhou Hikvision Digital Technology
+2857BE Hangzhou Hikvision Digital Technology
+4419B6 Hangzhou Hikvision Digital Technology
+4CBD8F Hangzhou Hikvision Digital Technology
+54C415 Hangzhou Hikvision Digital Technology
+A41437 Hangzhou Hikvision Digital Technology
+BCAD28 Hangzhou Hikvision Digital Technology
+C056E3 Hangzhou Hikvision Digital Technology
+C42F90 Hangzhou Hikvision Digital Technology
+
+# Dahua
+14A78B Zhejiang Dahua Technology
+38AF29 Zhejiang Dahua Technology
+3CEF8C Zhejiang Dahua Technology
+4C11BF Zhejiang Dahua Technology
+9002A9 Zhejiang Dahua Technology
+A0BD1D Zhejiang Dahua Technology
+BC325F Zhejiang Dahua Technology
+E0508B Zhejiang Dahua Technology
+
+# Axis
+00408C Axis Communications
+ACCC8E Axis Communications
+B8A44F Axis Communications
+E82725 Axis Communications
+
+# Other camera manufacturers
+0002D1 Vivotek
+0003C5 Mobotix
+000463 Bosch Security Systems
+00047D Pelco
+000918 Samsung Techwin
+000B82 Grandstream Networks
+000F7C ACTi
+0013E2 GeoVision
+001885 Avigilon
+001A07 Arecont Vision
+0080F0 Panasonic
+1CC316 Milesight Technology
+48EA63 Zhejiang Uniview Technologies
+EC71DB Reolink Innovation
+
+# Ubiquiti
+0418D6 Ubiquiti Networks
+24A43C Ubiquiti Networks
+44D9E7 Ubiquiti Networks
+687251 Ubiquiti Networks
+7483C2 Ubiquiti Networks
+788A20 Ubiquiti Networks
+802AA8 Ubiquiti Networks
+B4FBE4 Ubiquiti Networks
+DC9FDB Ubiquiti Networks
+E063DA Ubiquiti Networks
+F09FC2 Ubiquiti Networks
+FCECDA Ubiquiti Networks
+`
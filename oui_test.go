@@ -0,0 +1,98 @@
+package cameradar
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupVendor(t *testing.T) {
+	tests := []struct {
+		description string
+
+		mac string
+
+		expectedVendor string
+	}{
+		{
+			description: "known vendor",
+
+			mac: "AC:CC:8E:12:34:56",
+
+			expectedVendor: "Axis Communications",
+		},
+		{
+			description: "lowercase and dashes",
+
+			mac: "bc-ad-28-12-34-56",
+
+			expectedVendor: "Hangzhou Hikvision Digital Technology",
+		},
+		{
+			description: "bare hexadecimal digits",
+
+			mac: "00408c123456",
+
+			expectedVendor: "Axis Communications",
+		},
+		{
+			description: "unknown vendor",
+
+			mac: "02:42:AC:11:00:02",
+		},
+		{
+			description: "invalid address",
+
+			mac: "AC:CC",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Equal(t, test.expectedVendor, lookupVendor(test.mac))
+		})
+	}
+}
+
+func TestParseMACPrefixes(t *testing.T) {
+	vendors := parseMACPrefixes(`# Comment
+0002D1 Vivotek
+
+00408c   Axis Communications
+00408C1 Axis Communications Subsidiary
+invalid line
+ZZZZZZ Not hexadecimal
+`)
+
+	assert.Equal(t, map[string]string{
+		"0002D1":  "Vivotek",
+		"00408C":  "Axis Communications",
+		"00408C1": "Axis Communications Subsidiary",
+	}, vendors)
+}
+
+func TestEmbeddedMACPrefixes(t *testing.T) {
+	vendors := parseMACPrefixes(macPrefixes)
+
+	// Every entry of the embedded list is valid.
+	var entries int
+	for _, line := range strings.Split(macPrefixes, "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries++
+		}
+	}
+	assert.Len(t, vendors, entries)
+
+	for prefix, vendor := range vendors {
+		assert.Equal(t, vendor, lookupVendor(prefix+"123456"), prefix)
+	}
+}
+
+func TestMACPrefixesUpToDate(t *testing.T) {
+	prefixes, err := ioutil.ReadFile("dictionaries/mac-prefixes")
+
+	assert.NoError(t, err)
+	assert.Equal(t, string(prefixes), macPrefixes, "run go generate to update the built-in MAC address prefixes")
+}
@@ -0,0 +1,253 @@
+package cameradar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// playbackSampleDuration is how long RTP packets are counted once the first one arrived.
+const playbackSampleDuration = 500 * time.Millisecond
+
+// RTP transports.
+const (
+	TransportTCP = "tcp"
+	TransportUDP = "udp"
+)
+
+// transports are the RTP transports with which streams are set up, in order.
+// Interleaving RTP in the RTSP connection works behind NAT and firewalls, but
+// some cameras do not support it and answer with a 461 Unsupported Transport.
+var transports = []string{TransportTCP, TransportUDP}
+
+// interleavedTransport is the Transport header requesting RTP and RTCP packets to be
+// interleaved in the RTSP connection, on channels 0 and 1.
+const interleavedTransport = "RTP/AVP/TCP;unicast;interleaved=0-1"
+
+// transportHeader returns the Transport header with which to set up a stream using
+// the given RTP transport. For UDP, a pair of ports is listened on until the returned
+// function is called, so that concurrent requests never use the same ports, and the
+// connection on which RTP packets are received is returned.
+func transportHeader(transport string) (string, *net.UDPConn, func(), error) {
+	if transport == TransportTCP {
+		return interleavedTransport, nil, func() {}, nil
+	}
+
+	rtp, rtcp, err := listenRTP()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	closePorts := func() {
+		rtp.Close()
+		rtcp.Close()
+	}
+
+	return fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d", udpPort(rtp), udpPort(rtcp)), rtp, closePorts, nil
+}
+
+// playStream sets up the given route of the stream, plays it and waits for RTP packets
+// until the timeout. It returns the amount of packets received, the time between
+// the PLAY request and the first packet, and the RTP transport that was used, which
+// is UDP for interleaved routes when the handle can not receive interleaved packets.
+func (s *Scanner) playStream(ctx context.Context, stream Stream, route ValidRoute) (int, time.Duration, string) {
+	c, attackURL := s.newRequest(ctx, stream, route.Route, stream.Username, stream.Password, rtspSetup)
+
+	counter := &rtpCounter{}
+
+	// Interleaved packets can only be received by the native RTSP client,
+	// so UDP is used instead with libcurl.
+	transport := route.Transport
+	if transport == TransportTCP {
+		err := c.Setopt(optInterleaveFunc, func(frame []byte, _ interface{}) bool {
+			// Only count the RTP packets of the track, which are sent on channel 0.
+			if len(frame) < 4 || frame[1] != 0 {
+				return true
+			}
+			return counter.add(frame[4:])
+		})
+		if err != nil {
+			transport = TransportUDP
+		}
+	}
+
+	header, rtp, closePorts, err := transportHeader(transport)
+	if err != nil {
+		s.term.Errorf("Unable to listen for RTP packets: %v", err)
+		return 0, 0, transport
+	}
+	defer closePorts()
+
+	// Set up the first track of the stream.
+	_ = c.Setopt(optRTSPStreamURI, trackURL(attackURL, route.Tracks))
+	_ = c.Setopt(optRTSPTransport, header)
+
+	if code, err := s.perform(ctx, c, "SETUP", attackURL, stream.AuthenticationType); err != nil || code != httpOK {
+		return 0, 0, transport
+	}
+	defer teardown(c, attackURL)
+
+	_ = c.Setopt(optRTSPStreamURI, attackURL)
+	_ = c.Setopt(optRTSPRequest, rtspPlay)
+
+	counter.start = time.Now()
+	counter.deadline = counter.start.Add(s.timeout)
+	if code, err := s.perform(ctx, c, "PLAY", attackURL, stream.AuthenticationType); err != nil || code != httpOK {
+		return 0, 0, transport
+	}
+
+	if transport == TransportTCP {
+		// Receive the interleaved packets until the deadline.
+		_ = c.Setopt(optRTSPRequest, rtspReceive)
+		for !counter.done() && ctx.Err() == nil {
+			_ = c.Setopt(optTimeoutMS, int(time.Until(counter.deadline)/time.Millisecond)+1)
+			if c.Perform() != nil {
+				break
+			}
+		}
+		// Requests sent after receiving use the usual timeout.
+		_ = c.Setopt(optTimeoutMS, int(s.timeout/time.Millisecond))
+	} else {
+		receiveRTP(ctx, rtp, counter)
+	}
+
+	if s.verbose {
+		s.term.Debugln("PLAY", attackURL, transport, "RTSP/1.0 >", counter.packets, "RTP packets, first after", counter.latency)
+	}
+
+	return counter.packets, counter.latency, transport
+}
+
+// teardown ends the session set up on the given handle.
+func teardown(c Curler, streamURI string) {
+	_ = c.Setopt(optRTSPStreamURI, streamURI)
+	_ = c.Setopt(optRTSPRequest, rtspTeardown)
+	_ = c.Perform()
+}
+
+// trackURL returns the URL with which to set up the first video track of a stream,
+// or the first track if it has no video. Relative control URLs are relative to the
+// URL of the stream.
+func trackURL(streamURL string, tracks []Track) string {
+	if len(tracks) == 0 {
+		return streamURL
+	}
+
+	track := tracks[0]
+	for _, t := range tracks {
+		if t.Media == "video" {
+			track = t
+			break
+		}
+	}
+
+	switch {
+	case track.Control == "" || track.Control == "*":
+		return streamURL
+	case strings.HasPrefix(strings.ToLower(track.Control), "rtsp://"), strings.HasPrefix(strings.ToLower(track.Control), "rtsps://"):
+		return track.Control
+	default:
+		return strings.TrimSuffix(streamURL, "/") + "/" + track.Control
+	}
+}
+
+// listenRTP listens on a pair of consecutive UDP ports for RTP and RTCP, the
+// RTP one being even as required by RFC 3550.
+func listenRTP() (*net.UDPConn, *net.UDPConn, error) {
+	for i := 0; i < 10; i++ {
+		rtp, err := net.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		port := udpPort(rtp)
+		if port%2 != 0 {
+			rtp.Close()
+			continue
+		}
+
+		rtcp, err := net.ListenUDP("udp", &net.UDPAddr{Port: port + 1})
+		if err != nil {
+			rtp.Close()
+			continue
+		}
+
+		return rtp, rtcp, nil
+	}
+
+	return nil, nil, errors.New("no consecutive UDP ports available")
+}
+
+func udpPort(conn *net.UDPConn) int {
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// rtpCounter counts the RTP packets received when playing a stream until its
+// deadline, or for a short while once the first packet arrived.
+type rtpCounter struct {
+	start    time.Time
+	deadline time.Time
+
+	packets int
+	latency time.Duration
+}
+
+// add counts the given packet if it is an RTP packet, and returns whether more
+// packets should be received.
+func (r *rtpCounter) add(packet []byte) bool {
+	if !isRTP(packet) {
+		return !r.done()
+	}
+
+	r.packets++
+	if r.packets == 1 {
+		r.latency = time.Since(r.start)
+		if sample := time.Now().Add(playbackSampleDuration); sample.Before(r.deadline) {
+			r.deadline = sample
+		}
+	}
+
+	return !r.done()
+}
+
+func (r *rtpCounter) done() bool {
+	return !time.Now().Before(r.deadline)
+}
+
+// receiveRTP counts the RTP packets received on the given connection.
+func receiveRTP(ctx context.Context, conn net.PacketConn, counter *rtpCounter) {
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetReadDeadline(time.Now())
+		case <-finished:
+		}
+	}()
+
+	buf := make([]byte, 2048)
+	for ctx.Err() == nil {
+		err := conn.SetReadDeadline(counter.deadline)
+		if err != nil {
+			return
+		}
+
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		if !counter.add(buf[:n]) {
+			return
+		}
+	}
+}
+
+// isRTP returns whether the given packet looks like an RTP version 2 packet.
+func isRTP(packet []byte) bool {
+	return len(packet) >= 12 && packet[0]>>6 == 2
+}
@@ -0,0 +1,325 @@
+package cameradar
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeSession = "RTSP/1.0 200 OK\r\nCSeq: %s\r\nSession: 12345678;timeout=60\r\n\r\n"
+
+var clientPortRegexp = regexp.MustCompile(`client_port=(\d+)-`)
+
+// fakePlaybackHandler returns a handler which sends the given amount of RTP packets
+// once the stream is played, either interleaved in the RTSP connection if the server
+// supports it and the client asks for it, or to the client port of the session.
+func fakePlaybackHandler(t *testing.T, packets int, interleaved bool) func(req fakeRTSPRequest) string {
+	var clientPort string
+	return func(req fakeRTSPRequest) string {
+		switch req.method {
+		case "SETUP":
+			transport := req.header.Get("Transport")
+			if strings.Contains(transport, "interleaved=") {
+				if !interleaved {
+					return "RTSP/1.0 461 Unsupported Transport\r\nCSeq: %s\r\n\r\n"
+				}
+				clientPort = ""
+				return fakeSession
+			}
+
+			match := clientPortRegexp.FindStringSubmatch(transport)
+			if match == nil {
+				return "RTSP/1.0 461 Unsupported Transport\r\nCSeq: %s\r\n\r\n"
+			}
+			clientPort = match[1]
+			return fakeSession
+		case "PLAY":
+			if req.header.Get("Session") != "12345678" {
+				return "RTSP/1.0 454 Session Not Found\r\nCSeq: %s\r\n\r\n"
+			}
+
+			if clientPort == "" {
+				// RTCP packet on channel 1, which is not counted.
+				frames := "$\x01\x00\x0c\x80\xc8\x00\x06\x00\x00\x00\x00\x00\x00\x00\x00"
+				for i := 0; i < packets; i++ {
+					frames += "$\x00\x00\x0c" + string([]byte{0x80, 0x60, 0, byte(i), 0, 0, 0, 0, 0, 0, 0, 1})
+				}
+				return fakeSession + frames
+			}
+
+			go func() {
+				conn, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", clientPort))
+				if err != nil {
+					t.Errorf("unable to send RTP packets: %v", err)
+					return
+				}
+				defer conn.Close()
+
+				time.Sleep(10 * time.Millisecond)
+				// Not an RTP packet.
+				_, _ = conn.Write([]byte("garbage"))
+				for i := 0; i < packets; i++ {
+					_, _ = conn.Write([]byte{0x80, 0x60, 0, byte(i), 0, 0, 0, 0, 0, 0, 0, 1})
+				}
+			}()
+			return fakeSession
+		default:
+			return fakeOK
+		}
+	}
+}
+
+// noInterleaveCurler is a handle which, like libcurl, can not receive interleaved packets.
+type noInterleaveCurler struct {
+	Curler
+}
+
+func (c noInterleaveCurler) Setopt(opt int, param interface{}) error {
+	if opt == optInterleaveFunc {
+		return errors.New("unsupported option")
+	}
+	return c.Curler.Setopt(opt, param)
+}
+
+func (c noInterleaveCurler) Duphandle() Curler {
+	return noInterleaveCurler{c.Curler.Duphandle()}
+}
+
+func TestPlayStream(t *testing.T) {
+	tests := []struct {
+		description string
+
+		packets      int
+		transport    string
+		noInterleave bool
+
+		expectedPackets   int
+		expectedTransport string
+	}{
+		{
+			description: "media received",
+
+			packets:   3,
+			transport: TransportUDP,
+
+			expectedPackets:   3,
+			expectedTransport: TransportUDP,
+		},
+		{
+			description: "no media received",
+
+			packets:   0,
+			transport: TransportUDP,
+
+			expectedPackets:   0,
+			expectedTransport: TransportUDP,
+		},
+		{
+			description: "interleaved media received",
+
+			packets:   3,
+			transport: TransportTCP,
+
+			expectedPackets:   3,
+			expectedTransport: TransportTCP,
+		},
+		{
+			description: "no interleaved media received",
+
+			packets:   0,
+			transport: TransportTCP,
+
+			expectedPackets:   0,
+			expectedTransport: TransportTCP,
+		},
+		{
+			description: "interleaved media played over udp",
+
+			packets:      3,
+			transport:    TransportTCP,
+			noInterleave: true,
+
+			expectedPackets:   3,
+			expectedTransport: TransportUDP,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server := newFakeRTSPServer(t, fakePlaybackHandler(t, test.packets, test.expectedTransport == TransportTCP))
+			defer server.close()
+
+			var curl Curler = NewRTSPClient()
+			if test.noInterleave {
+				curl = noInterleaveCurler{curl}
+			}
+
+			scanner := &Scanner{
+				term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				curl:    curl,
+				timeout: 200 * time.Millisecond,
+			}
+
+			packets, latency, transport := scanner.playStream(context.Background(), server.stream(t), ValidRoute{
+				Route:     "live.sdp",
+				Tracks:    []Track{{Media: "video", Control: "trackID=1"}},
+				Transport: test.transport,
+			})
+
+			assert.Equal(t, test.expectedPackets, packets)
+			assert.Equal(t, test.expectedTransport, transport)
+			if test.expectedPackets > 0 {
+				assert.True(t, latency > 0)
+			} else {
+				assert.Equal(t, time.Duration(0), latency)
+			}
+
+			var methods, uris []string
+			for len(server.requests) > 0 {
+				req := <-server.requests
+				methods = append(methods, req.method)
+				uris = append(uris, req.uri)
+			}
+			assert.Equal(t, []string{"SETUP", "PLAY", "TEARDOWN"}, methods)
+			assert.Equal(t, server.url("live.sdp/trackID=1"), uris[0])
+		})
+	}
+}
+
+func TestValidateCameraStreamsPlayback(t *testing.T) {
+	server := newFakeRTSPServer(t, fakePlaybackHandler(t, 0, false))
+	defer server.close()
+
+	scanner := &Scanner{
+		term:               disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		curl:               NewRTSPClient(),
+		timeout:            100 * time.Millisecond,
+		playbackValidation: true,
+	}
+
+	target := server.stream(t)
+	target.ValidRoutes = []ValidRoute{{Route: "live.sdp"}}
+
+	result := scanner.validateCameraStreams(context.Background(), target)
+
+	// The stream can be set up, but never sends media.
+	assert.False(t, result.ValidRoutes[0].Available)
+	assert.Equal(t, 0, result.ValidRoutes[0].PacketsReceived)
+	assert.Equal(t, TransportUDP, result.ValidRoutes[0].Transport)
+}
+
+func TestValidateStreamTransports(t *testing.T) {
+	tests := []struct {
+		description string
+
+		interleaved bool
+
+		expectedTransport  string
+		expectedTransports []string
+	}{
+		{
+			description: "interleaved transport supported",
+
+			interleaved: true,
+
+			expectedTransport:  TransportTCP,
+			expectedTransports: []string{"RTP/AVP/TCP;unicast;interleaved=0-1"},
+		},
+		{
+			description: "falls back to UDP on unsupported transport",
+
+			interleaved: false,
+
+			expectedTransport:  TransportUDP,
+			expectedTransports: []string{"RTP/AVP/TCP;unicast;interleaved=0-1", "RTP/AVP;unicast;client_port="},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server := newFakeRTSPServer(t, fakePlaybackHandler(t, 0, test.interleaved))
+			defer server.close()
+
+			scanner := &Scanner{
+				term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				curl:    NewRTSPClient(),
+				timeout: time.Second,
+			}
+
+			transport, ok := scanner.validateStream(context.Background(), server.stream(t), "live.sdp")
+
+			assert.True(t, ok)
+			assert.Equal(t, test.expectedTransport, transport)
+
+			var transports []string
+			for len(server.requests) > 0 {
+				req := <-server.requests
+				if req.method == "SETUP" {
+					transports = append(transports, req.header.Get("Transport"))
+				}
+			}
+			if assert.Len(t, transports, len(test.expectedTransports)) {
+				for i, expected := range test.expectedTransports {
+					assert.True(t, strings.HasPrefix(transports[i], expected), transports[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTrackURL(t *testing.T) {
+	tests := []struct {
+		description string
+
+		tracks []Track
+
+		expectedURL string
+	}{
+		{
+			description: "no tracks",
+
+			expectedURL: "rtsp://host/live",
+		},
+		{
+			description: "relative control",
+
+			tracks: []Track{{Media: "audio", Control: "trackID=2"}, {Media: "video", Control: "trackID=1"}},
+
+			expectedURL: "rtsp://host/live/trackID=1",
+		},
+		{
+			description: "absolute control",
+
+			tracks: []Track{{Media: "video", Control: "rtsp://host/live/track1"}},
+
+			expectedURL: "rtsp://host/live/track1",
+		},
+		{
+			description: "aggregate control",
+
+			tracks: []Track{{Media: "audio", Control: "*"}},
+
+			expectedURL: "rtsp://host/live",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Equal(t, test.expectedURL, trackURL("rtsp://host/live", test.tracks))
+		})
+	}
+}
+
+func TestIsRTP(t *testing.T) {
+	assert.True(t, isRTP([]byte{0x80, 0x60, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1}))
+	assert.False(t, isRTP([]byte{0x80, 0x60}))
+	assert.False(t, isRTP([]byte("RTSP/1.0 200")))
+}
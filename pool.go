@@ -0,0 +1,192 @@
+package cameradar
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxConcurrency     = 100
+	defaultMaxHostConcurrency = 1
+)
+
+// limiter bounds the number of attack requests running at the same time,
+// both globally and for each host. A nil limiter does not limit anything.
+type limiter struct {
+	global  chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+// hostSlots are the request slots of a host, which are kept only as long as
+// requests to the host are running or waiting for a slot.
+type hostSlots struct {
+	sem   chan struct{}
+	users int
+}
+
+func newLimiter(global, perHost int) *limiter {
+	if global < 1 {
+		global = 1
+	}
+
+	if perHost < 1 {
+		perHost = 1
+	}
+
+	return &limiter{
+		global:  make(chan struct{}, global),
+		perHost: perHost,
+		hosts:   make(map[string]*hostSlots),
+	}
+}
+
+// acquire blocks until a request can be made to the given host, or until
+// the given context is done, in which case its error is returned.
+func (l *limiter) acquire(ctx context.Context, host string) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	// The host slot is acquired first so that waiting for a busy host
+	// does not prevent other hosts from being attacked.
+	hostSem := l.join(host)
+	select {
+	case hostSem <- struct{}{}:
+	case <-ctx.Done():
+		l.leave(host)
+		return ctx.Err()
+	}
+
+	select {
+	case l.global <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		<-hostSem
+		l.leave(host)
+		return ctx.Err()
+	}
+}
+
+// release frees the slot acquired for the given host.
+func (l *limiter) release(host string) {
+	if l == nil {
+		return
+	}
+
+	<-l.global
+
+	// The slots of the host are still there, since the caller is one of their users.
+	l.mu.Lock()
+	hostSem := l.hosts[host].sem
+	l.mu.Unlock()
+
+	<-hostSem
+	l.leave(host)
+}
+
+// join returns the slots of the given host, and counts the caller as one of
+// their users until it calls leave.
+func (l *limiter) join(host string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slots, ok := l.hosts[host]
+	if !ok {
+		slots = &hostSlots{sem: make(chan struct{}, l.perHost)}
+		l.hosts[host] = slots
+	}
+	slots.users++
+
+	return slots.sem
+}
+
+// leave stops counting the caller as a user of the slots of the given host,
+// which are forgotten once they have no users left.
+func (l *limiter) leave(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slots := l.hosts[host]
+	slots.users--
+	if slots.users == 0 {
+		delete(l.hosts, host)
+	}
+}
+
+// attackStreams runs the given attack on each target concurrently, and returns
+// the updated targets in the same order.
+func (s *Scanner) attackStreams(targets []Stream, attack func(target Stream) Stream) []Stream {
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			targets[i] = attack(targets[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return targets
+}
+
+// attemptAll calls attempt for each index in [0, n) on the given stream, using up to
+// maxHostConcurrency workers. Each attempt counts against the limits of the worker
+// pool, and is followed by the attack interval. Once an attempt returns true or the
+// context is done, no new attempts are started.
+func (s *Scanner) attemptAll(ctx context.Context, stream Stream, n int, attempt func(i int) bool) {
+	workers := s.maxHostConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		mu   sync.Mutex
+		next int
+		done bool
+		wg   sync.WaitGroup
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if done || next >= n {
+					mu.Unlock()
+					return
+				}
+				i := next
+				next++
+				mu.Unlock()
+
+				if s.pool.acquire(ctx, stream.Address) != nil {
+					return
+				}
+				ok := attempt(i)
+				s.pool.release(stream.Address)
+
+				if ok {
+					mu.Lock()
+					done = true
+					mu.Unlock()
+				}
+
+				select {
+				case <-time.After(s.attackInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,159 @@
+package cameradar
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttemptAllLimits(t *testing.T) {
+	tests := []struct {
+		description string
+
+		hosts              int
+		maxConcurrency     int
+		maxHostConcurrency int
+
+		expectedMaxGlobal int32
+		expectedMaxHost   int32
+	}{
+		{
+			description: "one request per host",
+
+			hosts:              4,
+			maxConcurrency:     100,
+			maxHostConcurrency: 1,
+
+			expectedMaxGlobal: 4,
+			expectedMaxHost:   1,
+		},
+		{
+			description: "several requests per host",
+
+			hosts:              2,
+			maxConcurrency:     100,
+			maxHostConcurrency: 3,
+
+			expectedMaxGlobal: 6,
+			expectedMaxHost:   3,
+		},
+		{
+			description: "global limit",
+
+			hosts:              4,
+			maxConcurrency:     2,
+			maxHostConcurrency: 3,
+
+			expectedMaxGlobal: 2,
+			expectedMaxHost:   2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scanner := &Scanner{
+				pool:               newLimiter(test.maxConcurrency, test.maxHostConcurrency),
+				maxHostConcurrency: test.maxHostConcurrency,
+			}
+
+			var (
+				global, maxGlobal int32
+				mu                sync.Mutex
+				perHost           = make(map[string]int32)
+				maxHost           int32
+			)
+
+			var targets []Stream
+			for i := 0; i < test.hosts; i++ {
+				targets = append(targets, Stream{Address: fmt.Sprint("host", i)})
+			}
+
+			scanner.attackStreams(targets, func(target Stream) Stream {
+				scanner.attemptAll(context.Background(), target, 10, func(int) bool {
+					current := atomic.AddInt32(&global, 1)
+					mu.Lock()
+					if current > maxGlobal {
+						maxGlobal = current
+					}
+					perHost[target.Address]++
+					if perHost[target.Address] > maxHost {
+						maxHost = perHost[target.Address]
+					}
+					mu.Unlock()
+
+					time.Sleep(5 * time.Millisecond)
+
+					mu.Lock()
+					perHost[target.Address]--
+					mu.Unlock()
+					atomic.AddInt32(&global, -1)
+					return false
+				})
+				return target
+			})
+
+			assert.Equal(t, test.expectedMaxGlobal, maxGlobal)
+			assert.True(t, maxHost <= test.expectedMaxHost, "too many concurrent requests on a single host: %d", maxHost)
+		})
+	}
+}
+
+func TestLimiterForgetsIdleHosts(t *testing.T) {
+	l := newLimiter(10, 2)
+
+	assert.NoError(t, l.acquire(context.Background(), "a"))
+	assert.NoError(t, l.acquire(context.Background(), "a"))
+	assert.NoError(t, l.acquire(context.Background(), "b"))
+
+	// Both slots of the host are taken, so this can only fail.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, l.acquire(ctx, "a"))
+	assert.Len(t, l.hosts, 2)
+
+	l.release("a")
+	assert.Len(t, l.hosts, 2)
+
+	l.release("a")
+	l.release("b")
+	assert.Empty(t, l.hosts)
+}
+
+func TestAttemptAllStopsOnSuccess(t *testing.T) {
+	scanner := &Scanner{}
+
+	var attempts []int
+	scanner.attemptAll(context.Background(), Stream{}, 10, func(i int) bool {
+		attempts = append(attempts, i)
+		return i == 3
+	})
+
+	assert.Equal(t, []int{0, 1, 2, 3}, attempts)
+}
+
+func TestAttackStreamsKeepsOrder(t *testing.T) {
+	scanner := &Scanner{}
+
+	targets := []Stream{
+		{Address: "a", Port: 1},
+		{Address: "b", Port: 2},
+		{Address: "c", Port: 3},
+	}
+
+	results := scanner.attackStreams(targets, func(target Stream) Stream {
+		time.Sleep(time.Duration(4-target.Port) * time.Millisecond)
+		target.Device = target.Address
+		return target
+	})
+
+	assert.Equal(t, []Stream{
+		{Device: "a", Address: "a", Port: 1},
+		{Device: "b", Address: "b", Port: 2},
+		{Device: "c", Address: "c", Port: 3},
+	}, results)
+}
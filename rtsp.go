@@ -0,0 +1,987 @@
+package cameradar
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRTSPPort  = "554"
+	defaultRTSPSPort = "322"
+	rtspUserAgent    = "cameradar"
+
+	// progressInterval is the interval at which the progress function is called.
+	progressInterval = 100 * time.Millisecond
+
+	// maxBodySize is the largest response body accepted from a server, so that
+	// a hostile or broken camera can not make the client allocate huge buffers.
+	maxBodySize = 1 << 20
+)
+
+// errAborted is returned by Perform when the progress function aborted the request.
+var errAborted = errors.New("request aborted by progress function")
+
+// rtspMethods maps the libcurl RTSP request types to RTSP methods.
+var rtspMethods = map[int]string{
+	rtspOptions:  "OPTIONS",
+	rtspDescribe: "DESCRIBE",
+	rtspSetup:    "SETUP",
+	rtspPlay:     "PLAY",
+	rtspTeardown: "TEARDOWN",
+}
+
+// RTSPClient is a pure Go RTSP/1.0 client which implements the Curler interface.
+// It understands the libcurl options used by cameradar, which allows it to be
+// used instead of libcurl, for example in binaries built without cgo.
+type RTSPClient struct {
+	url       string
+	streamURI string
+	userPwd   string
+	transport string
+	request   int
+	httpAuth  int
+	timeout   time.Duration
+	write     func([]byte, interface{}) bool
+	// interleave receives the RTP and RTCP data interleaved in the connection.
+	interleave func([]byte, interface{}) bool
+	// header receives the status line and header lines of each response.
+	header func([]byte, interface{}) bool
+
+	progress   func(float64, float64, float64, float64, interface{}) bool
+	noProgress bool
+
+	// httpTunnel is whether RTSP is tunneled in HTTP.
+	httpTunnel bool
+
+	// TLS options, used for rtsps:// URLs.
+	verifyPeer bool
+	verifyHost bool
+	caInfo     string
+	rootCAs    *x509.CertPool
+
+	// peerCertificates is the certificate chain presented by the server, captured
+	// even when it could not be verified.
+	peerCertificates []*x509.Certificate
+
+	cseq         int
+	responseCode int
+	authAvail    int
+
+	// Like libcurl, the connection and session are kept between requests of the
+	// same handle while a session is running, so that a stream can be set up and
+	// then played.
+	conn     net.Conn
+	reader   *bufio.Reader
+	connAddr string
+	session  string
+}
+
+// rtspResponse is a response read from an RTSP server.
+type rtspResponse struct {
+	statusCode int
+	header     textproto.MIMEHeader
+	body       []byte
+}
+
+// NewRTSPClient creates a new native RTSP client with the same defaults as libcurl.
+func NewRTSPClient() *RTSPClient {
+	return &RTSPClient{
+		request:    rtspOptions,
+		httpAuth:   authBasic,
+		noProgress: true,
+		verifyPeer: true,
+		verifyHost: true,
+	}
+}
+
+// Setopt sets an option on the client. Only the libcurl options used by cameradar are supported.
+func (c *RTSPClient) Setopt(opt int, param interface{}) error {
+	var err error
+	switch opt {
+	case optURL:
+		c.url, err = stringParam(opt, param)
+	case optRTSPStreamURI:
+		c.streamURI, err = stringParam(opt, param)
+	case optUserPwd:
+		c.userPwd, err = stringParam(opt, param)
+	case optRTSPTransport:
+		c.transport, err = stringParam(opt, param)
+	case optRTSPRequest:
+		c.request, err = intParam(opt, param)
+	case optHTTPAuth:
+		c.httpAuth, err = intParam(opt, param)
+	case optTimeoutMS:
+		var timeout int
+		timeout, err = intParam(opt, param)
+		c.timeout = time.Duration(timeout) * time.Millisecond
+	case optWriteFunction:
+		write, ok := param.(func([]byte, interface{}) bool)
+		if !ok {
+			return fmt.Errorf("invalid parameter type %T for option %d", param, opt)
+		}
+		c.write = write
+	case optHeaderFunction:
+		header, ok := param.(func([]byte, interface{}) bool)
+		if !ok {
+			return fmt.Errorf("invalid parameter type %T for option %d", param, opt)
+		}
+		c.header = header
+	case optInterleaveFunc:
+		interleave, ok := param.(func([]byte, interface{}) bool)
+		if !ok {
+			return fmt.Errorf("invalid parameter type %T for option %d", param, opt)
+		}
+		c.interleave = interleave
+	case optProgressFunc:
+		progress, ok := param.(func(float64, float64, float64, float64, interface{}) bool)
+		if !ok {
+			return fmt.Errorf("invalid parameter type %T for option %d", param, opt)
+		}
+		c.progress = progress
+	case optNoProgress:
+		var noProgress int
+		noProgress, err = intParam(opt, param)
+		c.noProgress = noProgress != 0
+	case optSSLVerifyPeer:
+		var verify int
+		verify, err = intParam(opt, param)
+		c.verifyPeer = verify != 0
+	case optSSLVerifyHost:
+		var verify int
+		verify, err = intParam(opt, param)
+		c.verifyHost = verify != 0
+	case optCAInfo:
+		var path string
+		path, err = stringParam(opt, param)
+		if err == nil && path != c.caInfo {
+			err = c.loadCAInfo(path)
+		}
+	case optHTTPTunnel:
+		var tunnel int
+		tunnel, err = intParam(opt, param)
+		c.httpTunnel = tunnel != 0
+	case optNoSignal, optNoBody:
+		// Those options only make sense for libcurl.
+	default:
+		return fmt.Errorf("unsupported option %d", opt)
+	}
+
+	return err
+}
+
+// Perform sends the configured request and reads its response. If the server
+// requires authentication and credentials were given, the request is sent
+// again using the strongest authentication method allowed. Like with libcurl,
+// the request is aborted as soon as the progress function returns false.
+func (c *RTSPClient) Perform() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if c.progress != nil && !c.noProgress {
+		go c.watchProgress(ctx, cancel)
+	}
+
+	err := c.perform(ctx)
+	if err != nil && ctx.Err() != nil {
+		return errAborted
+	}
+
+	return err
+}
+
+func (c *RTSPClient) perform(ctx context.Context) error {
+	if c.request == rtspReceive {
+		return c.receive(ctx)
+	}
+
+	c.responseCode = 0
+	c.authAvail = authNone
+
+	method, ok := rtspMethods[c.request]
+	if !ok {
+		return fmt.Errorf("unsupported RTSP request type %d", c.request)
+	}
+
+	target, err := url.Parse(c.url)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", c.url, err)
+	}
+
+	streamURI := c.streamURI
+	if streamURI == "" {
+		streamURI = c.url
+	}
+
+	requestURI, err := url.Parse(streamURI)
+	if err != nil {
+		return fmt.Errorf("invalid stream URI %q: %v", streamURI, err)
+	}
+	// Credentials are never sent as part of the request URI.
+	requestURI.User = nil
+
+	username, password := c.credentials(target)
+	hasCredentials := username != "" || password != ""
+
+	conn, reader, err := c.connect(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	stop := unblockOnDone(ctx, conn)
+	res, err := c.exchange(conn, reader, method, requestURI.String(), username, password, hasCredentials)
+	stop()
+
+	// The connection is only kept while a session is running.
+	if err != nil || ctx.Err() != nil || c.session == "" || method == "TEARDOWN" {
+		c.closeConn()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.responseCode = res.statusCode
+
+	if c.write != nil && len(res.body) > 0 {
+		c.write(res.body, nil)
+	}
+
+	return nil
+}
+
+// receive reads the RTP and RTCP data interleaved in the connection of the running
+// session and passes it to the interleave function until the timeout, or until the
+// interleave function returns false, like the RECEIVE request of libcurl.
+func (c *RTSPClient) receive(ctx context.Context) error {
+	if c.conn == nil {
+		return errors.New("no running RTSP session to receive data from")
+	}
+
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+
+	err := c.conn.SetDeadline(deadline)
+	if err != nil {
+		c.closeConn()
+		return fmt.Errorf("unable to set deadline: %v", err)
+	}
+
+	stop := unblockOnDone(ctx, c.conn)
+	defer stop()
+
+	for {
+		frame, err := readInterleavedFrame(c.reader)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() && ctx.Err() == nil {
+				return nil
+			}
+
+			c.closeConn()
+			return fmt.Errorf("unable to receive interleaved data: %v", err)
+		}
+
+		if c.interleave != nil && !c.interleave(frame, nil) {
+			return nil
+		}
+	}
+}
+
+// unblockOnDone unblocks the reads and writes on the given connection once the
+// context is done, until the returned function is called.
+func unblockOnDone(ctx context.Context, conn net.Conn) func() {
+	finished := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-finished:
+		}
+	}()
+
+	return func() {
+		close(finished)
+		<-stopped
+	}
+}
+
+// exchange sends the request and reads its response, authenticating if needed.
+func (c *RTSPClient) exchange(conn net.Conn, reader *bufio.Reader, method, uri, username, password string, hasCredentials bool) (*rtspResponse, error) {
+	// Like libcurl, only send basic credentials preemptively when it is the only allowed method.
+	var authorization string
+	allowed := c.allowedAuth()
+	if hasCredentials && allowed == authBasic {
+		authorization = basicAuthorization(username, password)
+	}
+
+	res, err := c.roundTrip(conn, reader, method, uri, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.statusCode == httpUnauthorized {
+		c.authAvail = authMethods(res.header)
+
+		if hasCredentials {
+			authorization = c.authorization(res.header, allowed, username, password, method, uri)
+			if authorization != "" {
+				res, err = c.roundTrip(conn, reader, method, uri, authorization)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if session := res.header.Get("Session"); session != "" {
+		// The session identifier can be followed by a timeout parameter.
+		c.session = strings.TrimSpace(strings.SplitN(session, ";", 2)[0])
+	}
+	if method == "TEARDOWN" {
+		c.session = ""
+	}
+
+	return res, nil
+}
+
+// connect returns the connection of the running session if it targets the
+// same address, or a new connection otherwise.
+func (c *RTSPClient) connect(ctx context.Context, target *url.URL) (net.Conn, *bufio.Reader, error) {
+	address := c.targetAddress(target)
+
+	if c.conn != nil && c.connAddr == address {
+		if c.timeout > 0 {
+			err := c.conn.SetDeadline(time.Now().Add(c.timeout))
+			if err != nil {
+				c.closeConn()
+				return nil, nil, fmt.Errorf("unable to set deadline: %v", err)
+			}
+		}
+		return c.conn, c.reader, nil
+	}
+
+	c.closeConn()
+
+	conn, err := c.dial(ctx, target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	c.connAddr = address
+
+	return c.conn, c.reader, nil
+}
+
+// closeConn closes the connection of the client, which ends its session.
+func (c *RTSPClient) closeConn() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = nil
+	c.reader = nil
+	c.connAddr = ""
+	c.session = ""
+}
+
+// Getinfo returns information about the last performed request.
+func (c *RTSPClient) Getinfo(info CurlInfo) (interface{}, error) {
+	switch info {
+	case infoResponseCode:
+		return c.responseCode, nil
+	case infoHTTPAuthAvail:
+		return c.authAvail, nil
+	case infoCertInfo:
+		return c.peerCertificates, nil
+	default:
+		return nil, fmt.Errorf("unsupported info %d", info)
+	}
+}
+
+// Duphandle returns a new client with the same options.
+func (c *RTSPClient) Duphandle() Curler {
+	dup := *c
+	dup.cseq = 0
+	dup.responseCode = 0
+	dup.authAvail = authNone
+	dup.peerCertificates = nil
+	dup.conn = nil
+	dup.reader = nil
+	dup.connAddr = ""
+	dup.session = ""
+	return &dup
+}
+
+// watchProgress calls the progress function periodically until the given context
+// is done, and aborts the request if it returns false.
+func (c *RTSPClient) watchProgress(ctx context.Context, abort context.CancelFunc) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		if !c.progress(0, 0, 0, 0, nil) {
+			abort()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *RTSPClient) dial(ctx context.Context, target *url.URL) (net.Conn, error) {
+	if target.Scheme != "rtsp" && target.Scheme != "rtsps" {
+		return nil, fmt.Errorf("unsupported scheme %q", target.Scheme)
+	}
+
+	address := c.targetAddress(target)
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	if c.httpTunnel {
+		if target.Scheme != "rtsp" {
+			return nil, fmt.Errorf("unable to tunnel %q in HTTP", target.Scheme)
+		}
+		return dialTunnel(ctx, dialer, address, target.RequestURI(), c.timeout)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %q: %v", address, err)
+	}
+
+	if c.timeout > 0 {
+		err = conn.SetDeadline(time.Now().Add(c.timeout))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to set deadline: %v", err)
+		}
+	}
+
+	if target.Scheme == "rtsps" {
+		return c.handshake(ctx, conn, target.Hostname())
+	}
+
+	return conn, nil
+}
+
+// handshake establishes a TLS session on the given connection. Certificates are
+// verified manually so that the certificate chain of the server is captured even
+// when it is not trusted.
+func (c *RTSPClient) handshake(ctx context.Context, conn net.Conn, host string) (net.Conn, error) {
+	c.peerCertificates = nil
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return c.verifyCertificates(rawCerts, host)
+		},
+	})
+
+	stop := unblockOnDone(ctx, conn)
+	err := tlsConn.Handshake()
+	stop()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %q failed: %v", conn.RemoteAddr(), err)
+	}
+
+	return tlsConn, nil
+}
+
+// verifyCertificates parses the certificate chain sent by the server and, like
+// libcurl, verifies that it is trusted unless peer verification is disabled, and
+// that it is valid for the host unless host verification is disabled.
+func (c *RTSPClient) verifyCertificates(rawCerts [][]byte, host string) error {
+	certificates := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("invalid certificate: %v", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	c.peerCertificates = certificates
+
+	if len(certificates) == 0 {
+		return errors.New("no certificate sent by the server")
+	}
+
+	if c.verifyPeer {
+		intermediates := x509.NewCertPool()
+		for _, certificate := range certificates[1:] {
+			intermediates.AddCert(certificate)
+		}
+
+		_, err := certificates[0].Verify(x509.VerifyOptions{
+			Roots:         c.rootCAs,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.verifyHost {
+		return certificates[0].VerifyHostname(host)
+	}
+
+	return nil
+}
+
+// loadCAInfo loads the certificate authorities of the given PEM bundle, which are
+// then trusted instead of the ones of the system.
+func (c *RTSPClient) loadCAInfo(path string) error {
+	c.caInfo = path
+	c.rootCAs = nil
+	if path == "" {
+		return nil
+	}
+
+	bundle, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read CA bundle: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return fmt.Errorf("no certificates found in CA bundle %q", path)
+	}
+	c.rootCAs = pool
+
+	return nil
+}
+
+// targetAddress returns the address to connect to for the given URL, using the
+// default port of its scheme, or of HTTP when tunneling, if it has none.
+func (c *RTSPClient) targetAddress(target *url.URL) string {
+	port := target.Port()
+	if port == "" {
+		switch {
+		case c.httpTunnel:
+			port = defaultTunnelPort
+		case target.Scheme == "rtsps":
+			port = defaultRTSPSPort
+		default:
+			port = defaultRTSPPort
+		}
+	}
+	return net.JoinHostPort(target.Hostname(), port)
+}
+
+func (c *RTSPClient) roundTrip(conn net.Conn, reader *bufio.Reader, method, uri, authorization string) (*rtspResponse, error) {
+	c.cseq++
+
+	var req strings.Builder
+	fmt.Fprintf(&req, "%s %s RTSP/1.0\r\n", method, uri)
+	fmt.Fprintf(&req, "CSeq: %d\r\n", c.cseq)
+	fmt.Fprintf(&req, "User-Agent: %s\r\n", rtspUserAgent)
+	if method == "DESCRIBE" {
+		req.WriteString("Accept: application/sdp\r\n")
+	}
+	if method == "SETUP" && c.transport != "" {
+		fmt.Fprintf(&req, "Transport: %s\r\n", c.transport)
+	}
+	if authorization != "" {
+		fmt.Fprintf(&req, "Authorization: %s\r\n", authorization)
+	}
+	if c.session != "" && method != "OPTIONS" && method != "DESCRIBE" {
+		fmt.Fprintf(&req, "Session: %s\r\n", c.session)
+	}
+	req.WriteString("\r\n")
+
+	_, err := io.WriteString(conn, req.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to send %s request: %v", method, err)
+	}
+
+	res, err := c.readResponse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s response: %v", method, err)
+	}
+
+	return res, nil
+}
+
+// readResponse reads the next response of the connection. The interleaved data
+// received before it is passed to the interleave function.
+func (c *RTSPClient) readResponse(reader *bufio.Reader) (*rtspResponse, error) {
+	for {
+		next, err := reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if next[0] != '$' {
+			break
+		}
+
+		frame, err := readInterleavedFrame(reader)
+		if err != nil {
+			return nil, err
+		}
+		if c.interleave != nil {
+			c.interleave(frame, nil)
+		}
+	}
+
+	tp := textproto.NewReader(reader)
+
+	statusLine, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(statusLine, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "RTSP/") {
+		return nil, fmt.Errorf("malformed status line %q", statusLine)
+	}
+
+	statusCode, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed status code %q", parts[1])
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	// Like with libcurl, header lines are passed to the header function one by one.
+	if c.header != nil {
+		c.header([]byte(statusLine+"\r\n"), nil)
+		for key, values := range header {
+			for _, value := range values {
+				c.header([]byte(key+": "+value+"\r\n"), nil)
+			}
+		}
+		c.header([]byte("\r\n"), nil)
+	}
+
+	res := &rtspResponse{
+		statusCode: statusCode,
+		header:     header,
+	}
+
+	contentLength := header.Get("Content-Length")
+	if contentLength != "" {
+		length, err := strconv.ParseInt(contentLength, 10, 64)
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("malformed content length %q", contentLength)
+		}
+		if length > maxBodySize {
+			return nil, fmt.Errorf("content length %d exceeds the maximum of %d bytes", length, maxBodySize)
+		}
+
+		res.body, err = ioutil.ReadAll(io.LimitReader(reader, length))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(res.body)) != length {
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+
+	return res, nil
+}
+
+// readInterleavedFrame reads an interleaved frame, which is made of a '$' sign,
+// a channel identifier, the length of the data on two bytes and the data.
+func readInterleavedFrame(reader *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0] != '$' {
+		return nil, fmt.Errorf("malformed interleaved frame header %q", header)
+	}
+
+	frame := make([]byte, 4+int(binary.BigEndian.Uint16(header[2:])))
+	copy(frame, header)
+	_, err = io.ReadFull(reader, frame[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// credentials returns the credentials to use, which are taken from the user
+// password option if it is set, or from the URL otherwise.
+func (c *RTSPClient) credentials(target *url.URL) (string, string) {
+	if c.userPwd != "" {
+		parts := strings.SplitN(c.userPwd, ":", 2)
+		if len(parts) == 1 {
+			return parts[0], ""
+		}
+		return parts[0], parts[1]
+	}
+
+	if target.User == nil {
+		return "", ""
+	}
+
+	password, _ := target.User.Password()
+	return target.User.Username(), password
+}
+
+// allowedAuth returns the authentication methods that the client is allowed to use.
+func (c *RTSPClient) allowedAuth() int {
+	// libcurl refuses to unset all authentication methods and keeps using basic.
+	if c.httpAuth == authNone {
+		return authBasic
+	}
+	return c.httpAuth
+}
+
+// authorization returns the value of the authorization header to answer the
+// challenges of the given response, or an empty string if none can be answered.
+func (c *RTSPClient) authorization(header textproto.MIMEHeader, allowed int, username, password, method, uri string) string {
+	challenges := parseChallenges(header)
+
+	if allowed&authDigest != 0 {
+		for _, challenge := range challenges {
+			if challenge.scheme == "digest" {
+				return digestAuthorization(challenge.params, username, password, method, uri)
+			}
+		}
+	}
+
+	if allowed&authBasic != 0 && allowed != authBasic {
+		for _, challenge := range challenges {
+			if challenge.scheme == "basic" {
+				return basicAuthorization(username, password)
+			}
+		}
+	}
+
+	return ""
+}
+
+// authChallenge is an authentication challenge sent in a WWW-Authenticate header.
+type authChallenge struct {
+	scheme string
+	params map[string]string
+}
+
+// parseChallenges parses the WWW-Authenticate headers of a response. A header can
+// hold several challenges, each starting with its scheme and followed by its
+// comma-separated parameters.
+func parseChallenges(header textproto.MIMEHeader) []authChallenge {
+	var challenges []authChallenge
+	for _, value := range header["Www-Authenticate"] {
+		for _, item := range splitAuthItems(value) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			// Parameters are key=value pairs, while challenges start with a scheme
+			// which is followed by a space or by nothing at all.
+			end := strings.IndexAny(item, " \t=")
+			if end < 0 || (item[end] != '=' && !strings.HasPrefix(strings.TrimLeft(item[end:], " \t"), "=")) {
+				challenge := authChallenge{
+					scheme: strings.ToLower(item),
+					params: make(map[string]string),
+				}
+				if end >= 0 {
+					challenge.scheme = strings.ToLower(item[:end])
+					challenge.params = parseAuthParams(item[end+1:])
+				}
+				challenges = append(challenges, challenge)
+				continue
+			}
+
+			if len(challenges) == 0 {
+				continue
+			}
+			for key, value := range parseAuthParams(item) {
+				challenges[len(challenges)-1].params[key] = value
+			}
+		}
+	}
+
+	return challenges
+}
+
+// splitAuthItems splits the value of a WWW-Authenticate header on the commas which
+// are not in quoted strings.
+func splitAuthItems(value string) []string {
+	var items []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && value[i] == '\\':
+			escaped = true
+		case value[i] == '"':
+			quoted = !quoted
+		case value[i] == ',' && !quoted:
+			items = append(items, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, value[start:])
+}
+
+// parseAuthParams parses a comma-separated list of key=value pairs in which
+// values can be quoted.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return params
+		}
+
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:end], s[end:]
+			}
+		}
+
+		params[key] = strings.TrimSpace(value)
+	}
+}
+
+// authMethods returns the authentication methods offered by the server, as a
+// libcurl authentication bitmask.
+func authMethods(header textproto.MIMEHeader) int {
+	methods := authNone
+	for _, challenge := range parseChallenges(header) {
+		switch challenge.scheme {
+		case "basic":
+			methods |= authBasic
+		case "digest":
+			methods |= authDigest
+		}
+	}
+	return methods
+}
+
+func basicAuthorization(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+func digestAuthorization(params map[string]string, username, password, method, uri string) string {
+	realm := params["realm"]
+	nonce := params["nonce"]
+
+	ha1 := md5Hex(username + ":" + realm + ":" + password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	var qop string
+	for _, option := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(option) == "auth" {
+			qop = "auth"
+		}
+	}
+
+	var response, cnonce string
+	const nc = "00000001"
+	if qop != "" {
+		cnonce = randomHex(8)
+		response = md5Hex(strings.Join([]string{ha1, nonce, nc, cnonce, qop, ha2}, ":"))
+	} else {
+		response = md5Hex(ha1 + ":" + nonce + ":" + ha2)
+	}
+
+	authorization := fmt.Sprintf(
+		`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username,
+		realm,
+		nonce,
+		uri,
+		response,
+	)
+
+	if opaque, ok := params["opaque"]; ok {
+		authorization += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+
+	if qop != "" {
+		authorization += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+
+	return authorization
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func stringParam(opt int, param interface{}) (string, error) {
+	s, ok := param.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid parameter type %T for option %d", param, opt)
+	}
+	return s, nil
+}
+
+func intParam(opt int, param interface{}) (int, error) {
+	switch v := param.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("invalid parameter type %T for option %d", param, opt)
+	}
+}
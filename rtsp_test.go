@@ -0,0 +1,645 @@
+package cameradar
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRTSPRequest is a request received by a fakeRTSPServer.
+type fakeRTSPRequest struct {
+	method string
+	uri    string
+	header textproto.MIMEHeader
+}
+
+// fakeRTSPServer is a minimal RTSP server which answers requests using a handler.
+type fakeRTSPServer struct {
+	listener net.Listener
+	handler  func(req fakeRTSPRequest) string
+	tls      bool
+
+	// tunnel is whether RTSP is tunneled in HTTP, in which case the GET
+	// connections of tunnels are stored by session cookie.
+	tunnel  bool
+	tunnels sync.Map
+
+	requests chan fakeRTSPRequest
+}
+
+func newFakeRTSPServer(t *testing.T, handler func(req fakeRTSPRequest) string) *fakeRTSPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to start fake RTSP server: %v", err)
+	}
+
+	server := &fakeRTSPServer{
+		listener: listener,
+		handler:  handler,
+		requests: make(chan fakeRTSPRequest, 100),
+	}
+
+	go server.serve()
+
+	return server
+}
+
+// newFakeRTSPSServer starts a fake RTSP server behind TLS, using a self-signed
+// certificate valid for 127.0.0.1 which is returned in PEM format.
+func newFakeRTSPSServer(t *testing.T, handler func(req fakeRTSPRequest) string) (*fakeRTSPServer, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake camera"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatalf("unable to start fake RTSPS server: %v", err)
+	}
+
+	server := &fakeRTSPServer{
+		listener: listener,
+		handler:  handler,
+		tls:      true,
+		requests: make(chan fakeRTSPRequest, 100),
+	}
+
+	go server.serve()
+
+	return server, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func (s *fakeRTSPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		if s.tunnel {
+			go s.serveTunnel(conn)
+			continue
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *fakeRTSPServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) != 3 {
+			return
+		}
+
+		req := fakeRTSPRequest{
+			method: parts[0],
+			uri:    parts[1],
+			header: header,
+		}
+		s.requests <- req
+
+		response := s.handler(req)
+		if response == "" {
+			return
+		}
+
+		_, err = fmt.Fprintf(conn, response, header.Get("CSeq"))
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRTSPServer) url(route string) string {
+	scheme := "rtsp"
+	if s.tls {
+		scheme = "rtsps"
+	}
+	return scheme + "://" + s.listener.Addr().String() + "/" + route
+}
+
+// stream returns a stream targeting the fake server.
+func (s *fakeRTSPServer) stream(t *testing.T) Stream {
+	host, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("invalid fake server address: %v", err)
+	}
+
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("invalid fake server port: %v", err)
+	}
+
+	return Stream{
+		Address:    host,
+		Port:       uint16(portNumber),
+		TLS:        s.tls,
+		HTTPTunnel: s.tunnel,
+	}
+}
+
+func (s *fakeRTSPServer) close() {
+	s.listener.Close()
+}
+
+const (
+	fakeOK           = "RTSP/1.0 200 OK\r\nCSeq: %s\r\n\r\n"
+	fakeNotFound     = "RTSP/1.0 404 Not Found\r\nCSeq: %s\r\n\r\n"
+	fakeBasic        = "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\nWWW-Authenticate: Basic realm=\"cameradar\"\r\n\r\n"
+	fakeDigest       = "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\nWWW-Authenticate: Digest realm=\"cameradar\", nonce=\"dcd98b7102dd2f0e8b11d0f600bfb0c0\"\r\n\r\n"
+	fakeBasicDigest  = "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\nWWW-Authenticate: Basic realm=\"cameradar\"\r\nWWW-Authenticate: Digest realm=\"cameradar\", nonce=\"dcd98b7102dd2f0e8b11d0f600bfb0c0\", qop=\"auth\"\r\n\r\n"
+	fakeDescribeBody = "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Type: application/sdp\r\nContent-Length: 4\r\n\r\nv=0\n"
+)
+
+// fakeAuthHandler returns a handler which requires the given credentials using
+// the given authentication scheme before answering with the given response.
+func fakeAuthHandler(scheme, challenge, username, password, response string) func(req fakeRTSPRequest) string {
+	return func(req fakeRTSPRequest) string {
+		authorization := req.header.Get("Authorization")
+		switch scheme {
+		case "basic":
+			if authorization == basicAuthorization(username, password) {
+				return response
+			}
+		case "digest":
+			if !strings.HasPrefix(authorization, "Digest ") {
+				return challenge
+			}
+
+			params := parseAuthParams(strings.TrimPrefix(authorization, "Digest "))
+			ha1 := md5Hex(username + ":" + params["realm"] + ":" + password)
+			ha2 := md5Hex(req.method + ":" + params["uri"])
+
+			expected := md5Hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+			if params["qop"] != "" {
+				expected = md5Hex(strings.Join([]string{ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+			}
+
+			if params["username"] == username && params["response"] == expected {
+				return response
+			}
+		}
+		return challenge
+	}
+}
+
+func TestRTSPClient(t *testing.T) {
+	tests := []struct {
+		description string
+
+		handler  func(req fakeRTSPRequest) string
+		request  int
+		route    string
+		userPwd  string
+		httpAuth int
+
+		expectedCode      int
+		expectedAuthAvail int
+		expectedBody      string
+		expectedMethod    string
+		expectedErr       bool
+	}{
+		{
+			description: "describe without authentication",
+
+			handler: func(req fakeRTSPRequest) string { return fakeOK },
+			request: rtspDescribe,
+			route:   "live.sdp",
+
+			expectedCode:   200,
+			expectedMethod: "DESCRIBE",
+		},
+		{
+			description: "route not found",
+
+			handler: func(req fakeRTSPRequest) string { return fakeNotFound },
+			request: rtspDescribe,
+			route:   "invalid",
+
+			expectedCode:   404,
+			expectedMethod: "DESCRIBE",
+		},
+		{
+			description: "detects basic authentication",
+
+			handler: func(req fakeRTSPRequest) string { return fakeBasic },
+			request: rtspDescribe,
+
+			expectedCode:      401,
+			expectedAuthAvail: authBasic,
+			expectedMethod:    "DESCRIBE",
+		},
+		{
+			description: "detects basic and digest authentication",
+
+			handler: func(req fakeRTSPRequest) string { return fakeBasicDigest },
+			request: rtspDescribe,
+
+			expectedCode:      401,
+			expectedAuthAvail: authBasic | authDigest,
+			expectedMethod:    "DESCRIBE",
+		},
+		{
+			description: "basic authentication with valid credentials",
+
+			handler:  fakeAuthHandler("basic", fakeBasic, "admin", "12345", fakeOK),
+			request:  rtspDescribe,
+			userPwd:  "admin:12345",
+			httpAuth: authBasic,
+
+			expectedCode:   200,
+			expectedMethod: "DESCRIBE",
+		},
+		{
+			description: "basic authentication with invalid credentials",
+
+			handler:  fakeAuthHandler("basic", fakeBasic, "admin", "12345", fakeOK),
+			request:  rtspDescribe,
+			userPwd:  "admin:admin",
+			httpAuth: authBasic,
+
+			expectedCode:      401,
+			expectedAuthAvail: authBasic,
+			expectedMethod:    "DESCRIBE",
+		},
+		{
+			description: "digest authentication with valid credentials",
+
+			handler:  fakeAuthHandler("digest", fakeDigest, "admin", "12345", fakeOK),
+			request:  rtspDescribe,
+			userPwd:  "admin:12345",
+			httpAuth: authDigest,
+
+			expectedCode:      200,
+			expectedAuthAvail: authDigest,
+			expectedMethod:    "DESCRIBE",
+		},
+		{
+			description: "digest authentication with qop and valid credentials",
+
+			handler:  fakeAuthHandler("digest", fakeBasicDigest, "admin", "12345", fakeOK),
+			request:  rtspDescribe,
+			userPwd:  "admin:12345",
+			httpAuth: authBasic | authDigest,
+
+			expectedCode:      200,
+			expectedAuthAvail: authBasic | authDigest,
+			expectedMethod:    "DESCRIBE",
+		},
+		{
+			description: "digest authentication with invalid credentials",
+
+			handler:  fakeAuthHandler("digest", fakeDigest, "admin", "12345", fakeOK),
+			request:  rtspDescribe,
+			userPwd:  "root:root",
+			httpAuth: authDigest,
+
+			expectedCode:      401,
+			expectedAuthAvail: authDigest,
+			expectedMethod:    "DESCRIBE",
+		},
+		{
+			description: "response body is written",
+
+			handler: func(req fakeRTSPRequest) string { return fakeDescribeBody },
+			request: rtspDescribe,
+
+			expectedCode:   200,
+			expectedBody:   "v=0\n",
+			expectedMethod: "DESCRIBE",
+		},
+		{
+			description: "setup request",
+
+			handler: func(req fakeRTSPRequest) string {
+				if req.header.Get("Transport") == "" {
+					return "RTSP/1.0 461 Unsupported Transport\r\nCSeq: %s\r\n\r\n"
+				}
+				return fakeOK
+			},
+			request: rtspSetup,
+
+			expectedCode:   200,
+			expectedMethod: "SETUP",
+		},
+		{
+			description: "connection closed without response",
+
+			handler: func(req fakeRTSPRequest) string { return "" },
+			request: rtspDescribe,
+
+			expectedErr:    true,
+			expectedMethod: "DESCRIBE",
+		},
+		{
+			description: "malformed response",
+
+			handler: func(req fakeRTSPRequest) string { return "HTTP/1.1 200 OK\r\n\r\n" },
+			request: rtspDescribe,
+
+			expectedErr:    true,
+			expectedMethod: "DESCRIBE",
+		},
+		{
+			description: "oversized body",
+
+			handler: func(req fakeRTSPRequest) string {
+				return "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Length: 1073741824\r\n\r\n"
+			},
+			request: rtspDescribe,
+
+			expectedErr:    true,
+			expectedMethod: "DESCRIBE",
+		},
+		{
+			description: "overflowing content length",
+
+			handler: func(req fakeRTSPRequest) string {
+				return "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Length: 9223372036854775807\r\n\r\n"
+			},
+			request: rtspDescribe,
+
+			expectedErr:    true,
+			expectedMethod: "DESCRIBE",
+		},
+		{
+			description: "truncated body",
+
+			handler: func(req fakeRTSPRequest) string {
+				return "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Length: 100\r\n\r\nv=0\n"
+			},
+			request: rtspDescribe,
+
+			expectedErr:    true,
+			expectedMethod: "DESCRIBE",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server := newFakeRTSPServer(t, test.handler)
+			defer server.close()
+
+			var body string
+			c := NewRTSPClient().Duphandle()
+			assert.NoError(t, c.Setopt(optURL, server.url(test.route)))
+			assert.NoError(t, c.Setopt(optRTSPStreamURI, server.url(test.route)))
+			assert.NoError(t, c.Setopt(optRTSPRequest, test.request))
+			assert.NoError(t, c.Setopt(optRTSPTransport, "RTP/AVP;unicast;client_port=33332-33333"))
+			assert.NoError(t, c.Setopt(optTimeoutMS, 1000))
+			assert.NoError(t, c.Setopt(optWriteFunction, func(b []byte, _ interface{}) bool {
+				body += string(b)
+				return true
+			}))
+			if test.userPwd != "" {
+				assert.NoError(t, c.Setopt(optUserPwd, test.userPwd))
+			}
+			if test.httpAuth != 0 {
+				assert.NoError(t, c.Setopt(optHTTPAuth, test.httpAuth))
+			}
+
+			err := c.Perform()
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			rc, err := c.Getinfo(infoResponseCode)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedCode, rc)
+
+			authAvail, err := c.Getinfo(infoHTTPAuthAvail)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedAuthAvail, authAvail)
+
+			assert.Equal(t, test.expectedBody, body)
+
+			req := <-server.requests
+			assert.Equal(t, test.expectedMethod, req.method)
+			assert.Equal(t, server.url(test.route), req.uri)
+		})
+	}
+}
+
+func TestRTSPClientCredentialsFromURL(t *testing.T) {
+	server := newFakeRTSPServer(t, fakeAuthHandler("basic", fakeBasic, "admin", "12345", fakeOK))
+	defer server.close()
+
+	c := NewRTSPClient()
+	assert.NoError(t, c.Setopt(optURL, strings.Replace(server.url("live.sdp"), "rtsp://", "rtsp://admin:12345@", 1)))
+	assert.NoError(t, c.Setopt(optRTSPRequest, rtspDescribe))
+
+	assert.NoError(t, c.Perform())
+
+	rc, err := c.Getinfo(infoResponseCode)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, rc)
+
+	// Credentials should not be part of the request URI.
+	req := <-server.requests
+	assert.Equal(t, server.url("live.sdp"), req.uri)
+}
+
+func TestRTSPClientTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(time.Second)
+	}()
+
+	c := NewRTSPClient()
+	assert.NoError(t, c.Setopt(optURL, "rtsp://"+listener.Addr().String()+"/live.sdp"))
+	assert.NoError(t, c.Setopt(optRTSPRequest, rtspDescribe))
+	assert.NoError(t, c.Setopt(optTimeoutMS, 10))
+
+	start := time.Now()
+	assert.Error(t, c.Perform())
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRTSPClientAbort(t *testing.T) {
+	server := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		time.Sleep(time.Second)
+		return fakeOK
+	})
+	defer server.close()
+
+	aborted := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(aborted) })
+
+	c := NewRTSPClient()
+	assert.NoError(t, c.Setopt(optURL, server.url("live.sdp")))
+	assert.NoError(t, c.Setopt(optRTSPRequest, rtspDescribe))
+	assert.NoError(t, c.Setopt(optTimeoutMS, 5000))
+	assert.NoError(t, c.Setopt(optNoProgress, 0))
+	assert.NoError(t, c.Setopt(optProgressFunc, func(float64, float64, float64, float64, interface{}) bool {
+		select {
+		case <-aborted:
+			return false
+		default:
+			return true
+		}
+	}))
+
+	start := time.Now()
+	assert.Equal(t, errAborted, c.Perform())
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRTSPClientTLS(t *testing.T) {
+	server, caBundle := newFakeRTSPSServer(t, func(req fakeRTSPRequest) string {
+		return fakeOK
+	})
+	defer server.close()
+
+	caFile, err := ioutil.TempFile("", "cameradar-ca")
+	if err != nil {
+		t.Fatalf("unable to create CA bundle: %v", err)
+	}
+	defer os.Remove(caFile.Name())
+	_, _ = caFile.Write(caBundle)
+	caFile.Close()
+
+	tests := []struct {
+		description string
+
+		options map[int]interface{}
+
+		expectedErr bool
+	}{
+		{
+			description: "untrusted certificate",
+
+			expectedErr: true,
+		},
+		{
+			description: "verification disabled",
+
+			options: map[int]interface{}{
+				optSSLVerifyPeer: 0,
+				optSSLVerifyHost: 0,
+			},
+		},
+		{
+			description: "certificate trusted by CA bundle",
+
+			options: map[int]interface{}{
+				optCAInfo: caFile.Name(),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			c := NewRTSPClient()
+			assert.NoError(t, c.Setopt(optTimeoutMS, 1000))
+			assert.NoError(t, c.Setopt(optURL, server.url("live.sdp")))
+			assert.NoError(t, c.Setopt(optRTSPRequest, rtspDescribe))
+			for opt, param := range test.options {
+				assert.NoError(t, c.Setopt(opt, param))
+			}
+
+			err := c.Perform()
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+
+				rc, err := c.Getinfo(infoResponseCode)
+				assert.NoError(t, err)
+				assert.Equal(t, httpOK, rc)
+			}
+
+			// The certificate is captured even when it is not trusted.
+			info, err := c.Getinfo(infoCertInfo)
+			assert.NoError(t, err)
+			if chain, ok := info.([]*x509.Certificate); assert.True(t, ok) && assert.Len(t, chain, 1) {
+				assert.Equal(t, "CN=fake camera", chain[0].Subject.String())
+			}
+		})
+	}
+
+	assert.Error(t, NewRTSPClient().Setopt(optCAInfo, "/does/not/exist"))
+}
+
+func TestRTSPClientSetopt(t *testing.T) {
+	c := NewRTSPClient()
+
+	assert.NoError(t, c.Setopt(optNoSignal, 1))
+	assert.NoError(t, c.Setopt(optNoBody, true))
+	assert.NoError(t, c.Setopt(optWriteFunction, doNotWrite))
+	assert.Error(t, c.Setopt(optURL, 42))
+	assert.Error(t, c.Setopt(optTimeoutMS, "42"))
+	assert.Error(t, c.Setopt(optWriteFunction, "not a function"))
+	assert.Error(t, c.Setopt(-1, nil))
+
+	_, err := c.Getinfo(-1)
+	assert.Error(t, err)
+
+	assert.NoError(t, c.Setopt(optRTSPRequest, 42))
+	assert.Error(t, c.Perform())
+
+	assert.NoError(t, c.Setopt(optRTSPRequest, rtspDescribe))
+	assert.NoError(t, c.Setopt(optURL, "http://localhost/"))
+	assert.Error(t, c.Perform())
+}
@@ -1,40 +1,165 @@
 package cameradar
 
 import (
+	"context"
 	"strings"
+	"sync"
+
 	"github.com/Ullaakut/nmap"
 )
 
+// rtspsPorts are the ports on which cameras usually serve RTSP over TLS.
+var rtspsPorts = map[uint16]bool{
+	322:  true,
+	7447: true,
+}
+
+// isTLS returns whether the service running on the given port is RTSP over TLS.
+func isTLS(port nmap.Port) bool {
+	switch {
+	case port.Service.Tunnel == "ssl", port.Service.Name == "rtsps":
+		return true
+	case port.Service.Name == "rtsp":
+		return false
+	default:
+		return rtspsPorts[port.ID]
+	}
+}
+
+// isHTTP returns whether the service running on the given port is plain HTTP,
+// in which RTSP can be tunneled.
+func isHTTP(port nmap.Port) bool {
+	name := port.Service.Name
+	return strings.HasPrefix(name, "http") && !strings.HasPrefix(name, "https") && port.Service.Tunnel != "ssl"
+}
+
 // Scan scans the target networks and tries to find RTSP streams within them.
 //
 // targets can be:
 //
-//    - a subnet (e.g.: 172.16.100.0/24)
-//    - an IP (e.g.: 172.16.100.10)
-//    - a hostname (e.g.: localhost)
-//    - a range of IPs (e.g.: 172.16.100.10-20)
+//   - a subnet (e.g.: 172.16.100.0/24)
+//   - an IP (e.g.: 172.16.100.10)
+//   - a hostname (e.g.: localhost)
+//   - a range of IPs (e.g.: 172.16.100.10-20)
 //
 // ports can be:
 //
-//    - one or multiple ports and port ranges separated by commas (e.g.: 554,8554-8560,18554-28554)
+//   - one or multiple ports and port ranges separated by commas (e.g.: 554,8554-8560,18554-28554)
 func (s *Scanner) Scan() ([]Stream, error) {
+	return s.ScanContext(context.Background())
+}
+
+// ScanContext is like Scan, but stops nmap when the given context is done,
+// in which case the context's error is returned along with the streams
+// found before the interruption, if any.
+func (s *Scanner) ScanContext(ctx context.Context) ([]Stream, error) {
 	s.term.StartStep("Scanning the network")
 
-	// Run nmap command to discover open ports on the specified targets & ports.
-	nmapScanner, err := nmap.NewScanner(
-		nmap.WithTargets(s.targets...),
-		nmap.WithPorts(s.ports...),
-		nmap.WithTimingTemplate(nmap.Timing(s.scanSpeed)),
-	)
-	if err != nil {
-		return nil, s.term.FailStepf("unable to create network scanner: %v", err)
+	var runner nmap.ScanRunner
+	if !s.connectScan {
+		var err error
+		runner, err = s.newNmapScanner(ctx)
+		switch {
+		case err == nmap.ErrNmapNotInstalled:
+			s.term.Infoln("nmap was not found, using the built-in scanner instead")
+			runner = nil
+		case err != nil:
+			return nil, s.term.FailStepf("unable to create network scanner: %v", err)
+		}
+	}
+
+	if runner == nil {
+		runner = s.newConnectScanner(ctx)
+	}
+
+	return s.scan(ctx, runner)
+}
+
+// newNmapScanner returns an nmap scanner for the targets. Since nmap can not scan
+// IPv4 and IPv6 targets at once, IPv6 targets are scanned separately.
+func (s *Scanner) newNmapScanner(ctx context.Context) (nmap.ScanRunner, error) {
+	ipv4Targets, ipv6Targets := splitTargets(s.targets)
+
+	type targetGroup struct {
+		targets []string
+		ipv6    bool
+	}
+
+	var groups []targetGroup
+	if len(ipv4Targets) > 0 || len(ipv6Targets) == 0 {
+		groups = append(groups, targetGroup{targets: ipv4Targets})
+	}
+	if len(ipv6Targets) > 0 {
+		groups = append(groups, targetGroup{targets: ipv6Targets, ipv6: true})
+	}
+
+	var runners scanRunners
+	for _, group := range groups {
+		options := []func(*nmap.Scanner){
+			nmap.WithTargets(group.targets...),
+			nmap.WithPorts(s.ports...),
+			nmap.WithTimingTemplate(nmap.Timing(s.scanSpeed)),
+			nmap.WithContext(ctx),
+		}
+		if group.ipv6 {
+			options = append(options, nmap.WithIPv6Scanning())
+		}
+
+		// Run nmap command to discover open ports on the specified targets & ports.
+		nmapScanner, err := nmap.NewScanner(options...)
+		if err != nil {
+			return nil, err
+		}
+		runners = append(runners, nmapScanner)
+	}
+
+	if len(runners) == 1 {
+		return runners[0], nil
+	}
+	return runners, nil
+}
+
+// splitTargets splits the given targets between IPv4 targets, which include
+// hostnames, and IPv6 targets.
+func splitTargets(targets []string) ([]string, []string) {
+	var ipv4Targets, ipv6Targets []string
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		switch {
+		case target == "":
+			continue
+		case isIPv6(target):
+			ipv6Targets = append(ipv6Targets, target)
+		default:
+			ipv4Targets = append(ipv4Targets, target)
+		}
 	}
+	return ipv4Targets, ipv6Targets
+}
 
-	return s.scan(nmapScanner)
+// scanRunners runs several scans one after the other, and merges their results.
+type scanRunners []nmap.ScanRunner
+
+func (r scanRunners) Run() (*nmap.Run, []string, error) {
+	merged := &nmap.Run{}
+	var warnings []string
+	for _, runner := range r {
+		result, runWarnings, err := runner.Run()
+		warnings = append(warnings, runWarnings...)
+		if err != nil {
+			return nil, warnings, err
+		}
+		merged.Hosts = append(merged.Hosts, result.Hosts...)
+	}
+	return merged, warnings, nil
 }
 
-func (s *Scanner) scan(nmapScanner nmap.ScanRunner) ([]Stream, error) {
+func (s *Scanner) scan(ctx context.Context, nmapScanner nmap.ScanRunner) ([]Stream, error) {
 	results, warnings, err := nmapScanner.Run()
+	if ctx.Err() != nil {
+		// nmap does not return partial results when it is interrupted.
+		return nil, s.term.FailStep(ctx.Err())
+	}
 	if err != nil {
 		return nil, s.term.FailStepf("error while scanning network: %v", err)
 	}
@@ -44,22 +169,24 @@ func (s *Scanner) scan(nmapScanner nmap.ScanRunner) ([]Stream, error) {
 	}
 
 	// Get streams from nmap results.
-	var streams []Stream
+	var streams, candidates []Stream
 	for _, host := range results.Hosts {
-		// When running in local network (via docker's --network host), MAC address get's added to Addresses slice so removing this
-		// eg.
-		//  Addresses: ([]nmap.Address) (len=2 cap=2) {
-		//  (nmap.Address) 192.168.0.76,
-		//  (nmap.Address) 00:16:6C:D7:C5:DA
-		// There must be a better way, maybe using nmap settings to make sure MAC is not stored 
-
-		tmp_addresses := host.Addresses
-		// emptying the slice
-		host.Addresses = append(host.Addresses[:0])
-		for _, address := range tmp_addresses {
-			if strings.Count(address.Addr, ":") < 2 {
-				host.Addresses = append(host.Addresses, address)
+		// When running in local network (via docker's --network host), the MAC address
+		// of hosts is added to their addresses. It is not an address to attack, but
+		// tells which manufacturer made the host.
+		var addresses []nmap.Address
+		var mac, vendor string
+		for _, address := range host.Addresses {
+			if address.AddrType == "mac" {
+				mac, vendor = address.Addr, address.Vendor
+				continue
 			}
+			addresses = append(addresses, address)
+		}
+		host.Addresses = addresses
+
+		if mac != "" && vendor == "" {
+			vendor = lookupVendor(mac)
 		}
 
 		for _, port := range host.Ports {
@@ -67,23 +194,96 @@ func (s *Scanner) scan(nmapScanner nmap.ScanRunner) ([]Stream, error) {
 				continue
 			}
 
-			if !strings.Contains(port.Service.Name, "rtsp") {
-				continue
+			tunnel := false
+			if !strings.Contains(port.Service.Name, "rtsp") && !rtspsPorts[port.ID] {
+				if !s.httpTunnel || !isHTTP(port) {
+					if s.serviceVerification {
+						for _, address := range host.Addresses {
+							candidates = append(candidates, Stream{
+								Device:         port.Service.Product,
+								Address:        address.Addr,
+								Port:           port.ID,
+								MACAddress:     mac,
+								HardwareVendor: vendor,
+							})
+						}
+					}
+					continue
+				}
+				tunnel = true
 			}
 
 			for _, address := range host.Addresses {
 				streams = append(streams, Stream{
-					Device:  port.Service.Product,
-					Address: address.Addr,
-					Port:    port.ID,
+					Device:         port.Service.Product,
+					Address:        address.Addr,
+					Port:           port.ID,
+					TLS:            !tunnel && isTLS(port),
+					HTTPTunnel:     tunnel,
+					MACAddress:     mac,
+					HardwareVendor: vendor,
 				})
 			}
 		}
 	}
 
+	streams = append(streams, s.verifyServices(ctx, candidates)...)
+	if ctx.Err() != nil {
+		// Keep the streams found so far so that they can still be reported.
+		return streams, s.term.FailStep(ctx.Err())
+	}
+
 	s.term.Debugf("Found %d RTSP streams\n", len(streams))
 
 	s.term.EndStep()
 
 	return streams, nil
 }
+
+// verifyServices sends an RTSP OPTIONS request to each of the given candidates,
+// which are open ports that nmap did not label as RTSP, and returns the ones that
+// answered with an RTSP status line. The Server header of their response is used
+// as their device model when nmap did not find it. Requests count against the
+// limits of the worker pool.
+func (s *Scanner) verifyServices(ctx context.Context, candidates []Stream) []Stream {
+	timeout := s.timeout
+	if timeout == 0 {
+		timeout = defaultConnectTimeout
+	}
+
+	verified := make([]bool, len(candidates))
+	var wg sync.WaitGroup
+	for i := range candidates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// Candidates are no longer probed once the context is done.
+			if ctx.Err() != nil || s.pool.acquire(ctx, candidates[i].Address) != nil {
+				return
+			}
+			defer s.pool.release(candidates[i].Address)
+
+			service, server, _ := probeService(ctx, candidates[i].Address, candidates[i].Port, timeout)
+			if service != "rtsp" {
+				return
+			}
+
+			verified[i] = true
+			if candidates[i].Device == "" {
+				candidates[i].Device = server
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var streams []Stream
+	for i, candidate := range candidates {
+		if verified[i] {
+			s.term.Debugf("Port %d of %s serves RTSP\n", candidate.Port, candidate.Address)
+			streams = append(streams, candidate)
+		}
+	}
+
+	return streams
+}
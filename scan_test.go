@@ -1,10 +1,13 @@
 package cameradar
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/Ullaakut/disgo"
 
@@ -72,19 +75,28 @@ func TestScan(t *testing.T) {
 			speed:   5,
 		},
 		{
-			description: "create new scanner with missing nmap installation",
+			description: "create new scanner with missing nmap installation, uses built-in scanner",
 
 			removePath: true,
 			ports:      []string{"80"},
+		},
+		{
+			description: "invalid ports with built-in scanner",
+
+			removePath: true,
+			ports:      []string{"rtsp"},
 
-			expectedErr: errors.New("unable to create network scanner: nmap binary was not found"),
+			expectedErr: errors.New(`error while scanning network: invalid port "rtsp"`),
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
 			if test.removePath {
+				defer os.Setenv("PATH", os.Getenv("PATH"))
 				os.Setenv("PATH", "")
+			} else if _, err := exec.LookPath("nmap"); err != nil {
+				t.Skip("nmap is not installed")
 			}
 
 			scanner := &Scanner{
@@ -110,6 +122,8 @@ func TestInternalScan(t *testing.T) {
 		nmapResult   *nmap.Run
 		nmapWarnings []string
 		nmapError    error
+		cancelled    bool
+		httpTunnel   bool
 
 		expectedStreams []Stream
 		expectedErr     error
@@ -162,6 +176,129 @@ func TestInternalScan(t *testing.T) {
 
 			expectedStreams: []Stream{validStream1, validStream2},
 		},
+		{
+			description: "rtsps streams",
+
+			nmapResult: &nmap.Run{
+				Hosts: []nmap.Host{
+					{
+						Addresses: []nmap.Address{
+							{
+								Addr: validStream1.Address,
+							},
+						},
+						Ports: []nmap.Port{
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 322,
+								Service: nmap.Service{
+									Name:    "rtsps",
+									Product: validStream1.Device,
+								},
+							},
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 7447,
+								Service: nmap.Service{
+									Name: "unknown",
+								},
+							},
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 8554,
+								Service: nmap.Service{
+									Name:   "rtsp-alt",
+									Tunnel: "ssl",
+								},
+							},
+						},
+					},
+				},
+			},
+
+			expectedStreams: []Stream{
+				{Device: validStream1.Device, Address: validStream1.Address, Port: 322, TLS: true},
+				{Address: validStream1.Address, Port: 7447, TLS: true},
+				{Address: validStream1.Address, Port: 8554, TLS: true},
+			},
+		},
+		{
+			description: "ipv6 stream with mac address",
+
+			nmapResult: &nmap.Run{
+				Hosts: []nmap.Host{
+					{
+						Addresses: []nmap.Address{
+							{
+								Addr:     "00:16:6C:D7:C5:DA",
+								AddrType: "mac",
+								Vendor:   "Samsung Electronics",
+							},
+							{
+								Addr:     "fd00::10",
+								AddrType: "ipv6",
+							},
+						},
+						Ports: []nmap.Port{
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 554,
+								Service: nmap.Service{
+									Name: "rtsp",
+								},
+							},
+						},
+					},
+				},
+			},
+
+			expectedStreams: []Stream{
+				{Address: "fd00::10", Port: 554, MACAddress: "00:16:6C:D7:C5:DA", HardwareVendor: "Samsung Electronics"},
+			},
+		},
+		{
+			description: "vendor found from mac address",
+
+			nmapResult: &nmap.Run{
+				Hosts: []nmap.Host{
+					{
+						Addresses: []nmap.Address{
+							{
+								Addr:     "172.16.100.10",
+								AddrType: "ipv4",
+							},
+							{
+								Addr:     "44:19:b6:01:02:03",
+								AddrType: "mac",
+							},
+						},
+						Ports: []nmap.Port{
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 554,
+								Service: nmap.Service{
+									Name: "rtsp",
+								},
+							},
+						},
+					},
+				},
+			},
+
+			expectedStreams: []Stream{
+				{Address: "172.16.100.10", Port: 554, MACAddress: "44:19:b6:01:02:03", HardwareVendor: "Hangzhou Hikvision Digital Technology"},
+			},
+		},
 		{
 			description: "two invalid targets, no error",
 
@@ -286,6 +423,85 @@ func TestInternalScan(t *testing.T) {
 
 			expectedStreams: nil,
 		},
+		{
+			description: "http ports without tunneling",
+
+			nmapResult: &nmap.Run{
+				Hosts: []nmap.Host{
+					{
+						Addresses: []nmap.Address{
+							{
+								Addr: validStream1.Address,
+							},
+						},
+						Ports: []nmap.Port{
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 80,
+								Service: nmap.Service{
+									Name:    "http",
+									Product: validStream1.Device,
+								},
+							},
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 443,
+								Service: nmap.Service{
+									Name: "https",
+								},
+							},
+						},
+					},
+				},
+			},
+
+			expectedStreams: nil,
+		},
+		{
+			description: "http ports with tunneling",
+
+			httpTunnel: true,
+			nmapResult: &nmap.Run{
+				Hosts: []nmap.Host{
+					{
+						Addresses: []nmap.Address{
+							{
+								Addr: validStream1.Address,
+							},
+						},
+						Ports: []nmap.Port{
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 80,
+								Service: nmap.Service{
+									Name:    "http",
+									Product: validStream1.Device,
+								},
+							},
+							{
+								State: nmap.State{
+									State: "open",
+								},
+								ID: 443,
+								Service: nmap.Service{
+									Name: "https",
+								},
+							},
+						},
+					},
+				},
+			},
+
+			expectedStreams: []Stream{
+				{Device: validStream1.Device, Address: validStream1.Address, Port: 80, HTTPTunnel: true},
+			},
+		},
 		{
 			description: "no hosts found",
 
@@ -299,6 +515,13 @@ func TestInternalScan(t *testing.T) {
 			nmapWarnings: []string{"invalid host"},
 			expectedErr:  errors.New("error while scanning network: scan failed"),
 		},
+		{
+			description: "scan interrupted",
+
+			cancelled:   true,
+			nmapError:   nmap.ErrScanTimeout,
+			expectedErr: context.Canceled,
+		},
 	}
 
 	for _, test := range tests {
@@ -308,10 +531,17 @@ func TestInternalScan(t *testing.T) {
 			nmapMock.On("Run").Return(test.nmapResult, test.nmapWarnings, test.nmapError)
 
 			scanner := &Scanner{
-				term: disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				term:       disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				httpTunnel: test.httpTunnel,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancelled {
+				cancel()
 			}
 
-			results, err := scanner.scan(nmapMock)
+			results, err := scanner.scan(ctx, nmapMock)
 
 			assert.Equal(t, test.expectedErr, err)
 			assert.Equal(t, test.expectedStreams, results, "wrong streams parsed")
@@ -321,3 +551,127 @@ func TestInternalScan(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyServices(t *testing.T) {
+	rtsp := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		return "RTSP/1.0 200 OK\r\nCSeq: %s\r\nServer: Hikvision-Webs\r\n\r\n"
+	})
+	defer rtsp.close()
+
+	named := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		return "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\nServer: Hikvision-Webs\r\n\r\n"
+	})
+	defer named.close()
+
+	http := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		return "HTTP/1.1 400 Bad Request\r\nServer: lighttpd\r\n\r\n"
+	})
+	defer http.close()
+
+	host := func(ports ...nmap.Port) *nmap.Run {
+		return &nmap.Run{
+			Hosts: []nmap.Host{
+				{
+					Addresses: []nmap.Address{{Addr: "127.0.0.1"}},
+					Ports:     ports,
+				},
+			},
+		}
+	}
+
+	port := func(server *fakeRTSPServer, name, product string) nmap.Port {
+		return nmap.Port{
+			ID:      server.stream(t).Port,
+			State:   nmap.State{State: "open"},
+			Service: nmap.Service{Name: name, Product: product},
+		}
+	}
+
+	tests := []struct {
+		description string
+
+		verification bool
+		nmapResult   *nmap.Run
+
+		expectedStreams []Stream
+	}{
+		{
+			description: "mislabeled rtsp ports are promoted",
+
+			verification: true,
+			nmapResult: host(
+				port(rtsp, "unknown", ""),
+				port(named, "http-alt", "Hikvision IP camera"),
+				port(http, "http", "lighttpd"),
+			),
+
+			expectedStreams: []Stream{
+				{Device: "Hikvision-Webs", Address: "127.0.0.1", Port: rtsp.stream(t).Port},
+				{Device: "Hikvision IP camera", Address: "127.0.0.1", Port: named.stream(t).Port},
+			},
+		},
+		{
+			description: "mislabeled rtsp ports are ignored without verification",
+
+			nmapResult: host(port(rtsp, "unknown", "")),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			nmapMock := &nmapMock{}
+
+			nmapMock.On("Run").Return(test.nmapResult, []string{}, nil)
+
+			scanner := &Scanner{
+				term:                disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+				timeout:             time.Second,
+				serviceVerification: test.verification,
+			}
+
+			results, err := scanner.scan(context.Background(), nmapMock)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedStreams, results)
+
+			nmapMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestVerifyServicesInterrupted(t *testing.T) {
+	rtsp := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		return fakeOK
+	})
+	defer rtsp.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	scanner := &Scanner{
+		term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		timeout: time.Second,
+		pool:    newLimiter(1, 1),
+	}
+
+	candidate := rtsp.stream(t)
+	streams := scanner.verifyServices(ctx, []Stream{candidate, candidate, candidate})
+
+	assert.Nil(t, streams)
+	assert.Empty(t, rtsp.requests, "candidates were probed after the interruption")
+}
+
+func TestSplitTargets(t *testing.T) {
+	ipv4Targets, ipv6Targets := splitTargets([]string{
+		"172.16.100.0/24",
+		" fd00::10 ",
+		"camera.local",
+		"",
+		"fe80::/120",
+		"172.16.100.10-20",
+		"fe80::1%eth0",
+	})
+
+	assert.Equal(t, []string{"172.16.100.0/24", "camera.local", "172.16.100.10-20"}, ipv4Targets)
+	assert.Equal(t, []string{"fd00::10", "fe80::/120", "fe80::1%eth0"}, ipv6Targets)
+}
@@ -7,10 +7,10 @@ import (
 
 	"github.com/Ullaakut/disgo"
 	"github.com/Ullaakut/disgo/style"
-	curl "github.com/Ullaakut/go-curl"
 )
 
 const (
+	defaultCredentialDictionaryPath = "${GOPATH}/src/github.com/Ullaakut/cameradar/dictionaries/credentials.json"
 	defaultRouteDictionaryPath      = "${GOPATH}/src/github.com/Ullaakut/cameradar/dictionaries/routes"
 )
 
@@ -18,7 +18,11 @@ const (
 // attacks all streams found to get their RTSP credentials.
 type Scanner struct {
 	curl Curler
-	term *disgo.Terminal
+	// nativeCurl is used to attack the streams that libcurl does not support,
+	// which are RTSPS streams and streams tunneled in HTTP.
+	nativeCurl Curler
+	term       *disgo.Terminal
+	pool       *limiter
 
 	targets                  []string
 	ports                    []string
@@ -27,39 +31,73 @@ type Scanner struct {
 	scanSpeed                int
 	attackInterval           time.Duration
 	timeout                  time.Duration
+	maxConcurrency           int
+	maxHostConcurrency       int
+	credentialDictionaryPath string
 	routeDictionaryPath      string
-	password				 string
-	username				 string
+	nativeRTSP               bool
+	password                 string
+	username                 string
+	firstChannel             int
+	lastChannel              int
+	playbackValidation       bool
+	tlsInsecure              bool
+	tlsCABundlePath          string
+	httpTunnel               bool
+	connectScan              bool
+	serviceVerification      bool
+	discoveryInterfaces      []string
+	onvif                    bool
+	onvifInventory           bool
 
+	credentials Credentials
 	routes      Routes
+
+	vendorRoutes []vendorRoutes
 }
 
 // New creates a new Cameradar Scanner and applies the given options.
 func New(options ...func(*Scanner)) (*Scanner, error) {
-	err := curl.GlobalInit(curl.GLOBAL_ALL)
-	if err != nil {
-		return nil, fmt.Errorf("unable to initialize curl library: %v", err)
-	}
-
-	handle := curl.EasyInit()
-	if handle == nil {
-		return nil, fmt.Errorf("unable to initialize curl handle: %v", err)
-	}
-
 	scanner := &Scanner{
-		curl:                     &Curl{CURL: handle},
+		credentialDictionaryPath: defaultCredentialDictionaryPath,
 		routeDictionaryPath:      defaultRouteDictionaryPath,
+		maxConcurrency:           defaultMaxConcurrency,
+		maxHostConcurrency:       defaultMaxHostConcurrency,
+		firstChannel:             defaultFirstChannel,
+		lastChannel:              defaultLastChannel,
 	}
 
 	for _, option := range options {
 		option(scanner)
 	}
 
+	var err error
+	if scanner.nativeRTSP {
+		scanner.curl = NewRTSPClient()
+	} else {
+		scanner.curl, err = newCurl()
+		if err != nil {
+			return nil, err
+		}
+		scanner.nativeCurl = NewRTSPClient()
+	}
+
+	if scanner.tlsCABundlePath != "" {
+		// Load the CA bundle once, so that handles duplicated from this one share it.
+		err = scanner.nativeHandle().Setopt(optCAInfo, scanner.tlsCABundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load CA bundle: %v", err)
+		}
+	}
+
+	scanner.pool = newLimiter(scanner.maxConcurrency, scanner.maxHostConcurrency)
+
 	gopath := os.Getenv("GOPATH")
-	if gopath == "" && scanner.routeDictionaryPath == defaultRouteDictionaryPath {
+	if gopath == "" && (scanner.credentialDictionaryPath == defaultCredentialDictionaryPath || scanner.routeDictionaryPath == defaultRouteDictionaryPath) {
 		disgo.Errorln(style.Failure("No $GOPATH was found.\nDictionaries may not be loaded properly, please set your $GOPATH to use the default dictionaries."))
 	}
 
+	scanner.credentialDictionaryPath = os.ExpandEnv(scanner.credentialDictionaryPath)
 	scanner.routeDictionaryPath = os.ExpandEnv(scanner.routeDictionaryPath)
 
 	scanner.term = disgo.NewTerminal(
@@ -71,6 +109,12 @@ func New(options ...func(*Scanner)) (*Scanner, error) {
 		return nil, fmt.Errorf("unable to parse target file: %v", err)
 	}
 
+	scanner.term.StartStepf("Loading credentials")
+	err = scanner.LoadCredentials()
+	if err != nil {
+		return nil, scanner.term.FailStepf("unable to load credentials dictionary: %v", err)
+	}
+
 	scanner.term.StartStepf("Loading routes")
 	err = scanner.LoadRoutes()
 	if err != nil {
@@ -110,6 +154,14 @@ func WithVerbose(verbose bool) func(s *Scanner) {
 	}
 }
 
+// WithCustomCredentials specifies a custom credential dictionary
+// to use for the attacks.
+func WithCustomCredentials(dictionaryPath string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.credentialDictionaryPath = dictionaryPath
+	}
+}
+
 // WithCustomRoutes specifies a custom route dictionary
 // to use for the attacks.
 func WithCustomRoutes(dictionaryPath string) func(s *Scanner) {
@@ -118,6 +170,15 @@ func WithCustomRoutes(dictionaryPath string) func(s *Scanner) {
 	}
 }
 
+// WithNativeRTSP specifies whether or not to use the built-in RTSP client
+// instead of libcurl to attack streams. When cameradar is built without cgo,
+// the built-in client is always used.
+func WithNativeRTSP(native bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.nativeRTSP = native
+	}
+}
+
 // WithScanSpeed specifies the speed at which the scan should be executed. Faster
 // means easier to detect, slower has bigger timeout values and is more silent.
 func WithScanSpeed(speed int) func(s *Scanner) {
@@ -135,6 +196,24 @@ func WithAttackInterval(interval time.Duration) func(s *Scanner) {
 	}
 }
 
+// WithMaxConcurrency specifies the maximum amount of attack requests that
+// can be running at the same time, across all hosts.
+func WithMaxConcurrency(max int) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.maxConcurrency = max
+	}
+}
+
+// WithMaxHostConcurrency specifies the maximum amount of attack requests that
+// can be running at the same time on a single host. Increasing it allows several
+// routes or credentials of a camera to be tried in parallel, but some cameras
+// might not be able to handle many simultaneous connections.
+func WithMaxHostConcurrency(max int) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.maxHostConcurrency = max
+	}
+}
+
 // WithTimeout specifies the amount of time after which attack requests should
 // timeout. This should be high if the network you are attacking has a poor
 // connectivity or that you are located far away from it.
@@ -144,14 +223,105 @@ func WithTimeout(timeout time.Duration) func(s *Scanner) {
 	}
 }
 
+// WithPassword specifies the password of the credentials to try
+// before the ones of the credentials dictionary.
 func WithPassword(password string) func(s *Scanner) {
 	return func(s *Scanner) {
 		s.password = password
 	}
 }
 
+// WithUsername specifies the username of the credentials to try
+// before the ones of the credentials dictionary.
 func WithUsername(username string) func(s *Scanner) {
 	return func(s *Scanner) {
 		s.username = username
 	}
-}
\ No newline at end of file
+}
+
+// WithChannelRange specifies the channels with which the {channel} placeholder
+// of route templates is replaced, when the template does not specify its own range,
+// and the channels to enumerate on NVRs.
+func WithChannelRange(first, last int) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.firstChannel = first
+		s.lastChannel = last
+	}
+}
+
+// WithPlaybackValidation specifies whether streams should be played to validate
+// them. When enabled, routes are only considered available once RTP packets are
+// received from them, instead of as soon as they can be set up.
+func WithPlaybackValidation(enabled bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.playbackValidation = enabled
+	}
+}
+
+// WithTLSInsecure specifies whether the certificates of RTSPS streams should be
+// accepted without being verified. Most cameras use self-signed certificates.
+func WithTLSInsecure(insecure bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.tlsInsecure = insecure
+	}
+}
+
+// WithTLSCABundle specifies the path of a PEM bundle of the certificate authorities
+// to trust when verifying the certificates of RTSPS streams, instead of the ones
+// of the system.
+func WithTLSCABundle(path string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.tlsCABundlePath = path
+	}
+}
+
+// WithHTTPTunnel specifies whether the HTTP ports found by the scan should be kept,
+// in order to attack them by tunneling RTSP in HTTP, which some cameras only allow.
+func WithHTTPTunnel(enabled bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.httpTunnel = enabled
+	}
+}
+
+// WithConnectScan specifies whether the built-in TCP connect scanner should be
+// used instead of nmap, which is not always available and usually requires root
+// privileges. The built-in scanner is always used when nmap is not installed.
+func WithConnectScan(enabled bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.connectScan = enabled
+	}
+}
+
+// WithServiceVerification specifies whether an RTSP OPTIONS request should be sent
+// to the open ports that were not identified as RTSP by the scan, in order to find
+// RTSP servers that nmap mislabels.
+func WithServiceVerification(enabled bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.serviceVerification = enabled
+	}
+}
+
+// WithDiscoveryInterfaces specifies the network interfaces on which WS-Discovery
+// probes are sent. By default, they are sent on every interface which is up and
+// supports multicast.
+func WithDiscoveryInterfaces(interfaces []string) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.discoveryInterfaces = interfaces
+	}
+}
+
+// WithONVIF specifies whether the stream URIs of ONVIF cameras should be retrieved
+// from their media service before attacking their routes.
+func WithONVIF(enabled bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.onvif = enabled
+	}
+}
+
+// WithONVIFInventory specifies whether the device information and capabilities of
+// ONVIF cameras should be retrieved once their credentials are found.
+func WithONVIFInventory(enabled bool) func(s *Scanner) {
+	return func(s *Scanner) {
+		s.onvifInventory = enabled
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"testing"
 	"time"
 
-	curl "github.com/Ullaakut/go-curl"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,9 +28,6 @@ func TestNew(t *testing.T) {
 		loadCredsFail   bool
 		loadRoutesFail  bool
 
-		curlGlobalFail bool
-		curlEasyFail   bool
-
 		expectedErr bool
 	}{
 		{
@@ -65,20 +61,6 @@ func TestNew(t *testing.T) {
 
 			expectedErr: true,
 		},
-		{
-			description: "curl fails to init",
-
-			curlGlobalFail: true,
-
-			expectedErr: true,
-		},
-		{
-			description: "curl fails to create handle",
-
-			curlEasyFail: true,
-
-			expectedErr: true,
-		},
 		{
 			description: "gopath not set and default dicts",
 
@@ -97,8 +79,9 @@ func TestNew(t *testing.T) {
 			os.Setenv("GOPATH", "")
 
 			if test.loadTargetsFail {
+				// A directory can be opened but not read, even when running as root.
 				test.targets = []string{generateTmpFileName(i, "targets")}
-				ioutil.WriteFile(test.targets[0], []byte(`0.0.0.0`), 0000)
+				os.Mkdir(test.targets[0], 0755)
 			}
 
 			if !test.loadCredsFail && test.customCredentials == "" {
@@ -111,9 +94,6 @@ func TestNew(t *testing.T) {
 				ioutil.WriteFile(test.customRoutes, []byte(`live.sdp`), 0644)
 			}
 
-			curl.TestGlobalFail = test.curlGlobalFail
-			curl.TestEasyFail = test.curlEasyFail
-
 			scanner, err := New(
 				WithTargets(test.targets),
 				WithPorts(test.ports),
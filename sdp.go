@@ -0,0 +1,173 @@
+package cameradar
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Track is a media track of a stream, as described by the SDP of its route.
+type Track struct {
+	Media       string            `json:"media"`
+	Codec       string            `json:"codec"`
+	Encoding    string            `json:"encoding"`
+	PayloadType int               `json:"payloadType"`
+	ClockRate   int               `json:"clockRate,omitempty"`
+	Control     string            `json:"control,omitempty"`
+	Framerate   float64           `json:"framerate,omitempty"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+
+	// Video format, decoded from the parameter sets of H.264 and H.265 tracks.
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	Level   string `json:"level,omitempty"`
+}
+
+// staticPayloadTypes are the encodings of the static RTP payload types used by cameras,
+// which do not need to be described with an rtpmap attribute.
+var staticPayloadTypes = map[int]struct {
+	encoding  string
+	clockRate int
+}{
+	0:  {"PCMU", 8000},
+	8:  {"PCMA", 8000},
+	26: {"JPEG", 90000},
+}
+
+// codecs maps RTP encoding names to the names of their codecs.
+var codecs = map[string]string{
+	"H264":          "H.264",
+	"H265":          "H.265",
+	"HEVC":          "H.265",
+	"JPEG":          "MJPEG",
+	"MPEG4-GENERIC": "AAC",
+	"MP4A-LATM":     "AAC",
+	"PCMU":          "G.711",
+	"PCMA":          "G.711",
+}
+
+// parseSDP parses the media tracks of a session description. Only the first payload
+// type of each media description is kept, since it is the preferred one.
+func parseSDP(sdp string) []Track {
+	var (
+		tracks           []Track
+		sessionFramerate float64
+	)
+
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+
+		value := line[2:]
+		switch line[0] {
+		case 'm':
+			fields := strings.Fields(value)
+			if len(fields) < 4 {
+				continue
+			}
+
+			track := Track{
+				Media:       fields[0],
+				PayloadType: -1,
+				Framerate:   sessionFramerate,
+			}
+
+			payloadType, err := strconv.Atoi(fields[3])
+			if err == nil {
+				track.PayloadType = payloadType
+				if static, ok := staticPayloadTypes[payloadType]; ok {
+					track.Encoding = static.encoding
+					track.ClockRate = static.clockRate
+					track.Codec = codecs[static.encoding]
+				}
+			}
+
+			tracks = append(tracks, track)
+		case 'a':
+			if len(tracks) == 0 {
+				name, attr := splitAttribute(value)
+				if name == "framerate" || name == "x-framerate" {
+					sessionFramerate, _ = strconv.ParseFloat(attr, 64)
+				}
+				continue
+			}
+
+			parseMediaAttribute(&tracks[len(tracks)-1], value)
+		}
+	}
+
+	for i := range tracks {
+		tracks[i].decodeParameterSets()
+	}
+
+	return tracks
+}
+
+func parseMediaAttribute(track *Track, value string) {
+	name, attr := splitAttribute(value)
+	switch name {
+	case "control":
+		track.Control = attr
+	case "framerate", "x-framerate":
+		track.Framerate, _ = strconv.ParseFloat(attr, 64)
+	case "rtpmap":
+		payloadType, description := splitPayloadType(attr)
+		if payloadType < 0 || payloadType != track.PayloadType {
+			return
+		}
+
+		// Format: <encoding name>/<clock rate>[/<encoding parameters>]
+		parts := strings.Split(description, "/")
+		track.Encoding = strings.ToUpper(parts[0])
+		track.Codec = codecs[track.Encoding]
+		if track.Codec == "" {
+			track.Codec = track.Encoding
+		}
+		if len(parts) > 1 {
+			track.ClockRate, _ = strconv.Atoi(parts[1])
+		}
+	case "fmtp":
+		payloadType, parameters := splitPayloadType(attr)
+		if payloadType < 0 || payloadType != track.PayloadType {
+			return
+		}
+
+		track.Parameters = make(map[string]string)
+		for _, parameter := range strings.Split(parameters, ";") {
+			parts := strings.SplitN(strings.TrimSpace(parameter), "=", 2)
+			if parts[0] == "" {
+				continue
+			}
+			if len(parts) == 1 {
+				track.Parameters[parts[0]] = ""
+				continue
+			}
+			track.Parameters[parts[0]] = parts[1]
+		}
+	}
+}
+
+// splitAttribute splits an SDP attribute into its name and value.
+func splitAttribute(attribute string) (string, string) {
+	parts := strings.SplitN(attribute, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
+
+// splitPayloadType splits the value of an rtpmap or fmtp attribute into its
+// payload type and the rest of the value.
+func splitPayloadType(value string) (int, string) {
+	parts := strings.SplitN(value, " ", 2)
+	payloadType, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return -1, ""
+	}
+	if len(parts) == 1 {
+		return payloadType, ""
+	}
+	return payloadType, strings.TrimSpace(parts[1])
+}
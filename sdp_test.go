@@ -0,0 +1,162 @@
+package cameradar
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeSDP = "v=0\r\n" +
+	"o=- 1 1 IN IP4 127.0.0.1\r\n" +
+	"s=Media Presentation\r\n" +
+	"a=control:*\r\n" +
+	"a=x-framerate:15\r\n" +
+	"t=0 0\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=fmtp:96 profile-level-id=420029; packetization-mode=1; sprop-parameter-sets=Z00AKpY1QPAET8s3AQEBAg==,aO4xsg==\r\n" +
+	"a=control:trackID=1\r\n" +
+	"a=framerate:25.000000\r\n" +
+	"m=audio 0 RTP/AVP 0\r\n" +
+	"a=control:trackID=2\r\n"
+
+func TestParseSDP(t *testing.T) {
+	tests := []struct {
+		description string
+
+		sdp string
+
+		expectedTracks []Track
+	}{
+		{
+			description: "h264 and g711",
+
+			sdp: fakeSDP,
+
+			expectedTracks: []Track{
+				{
+					Media:       "video",
+					Codec:       "H.264",
+					Encoding:    "H264",
+					PayloadType: 96,
+					ClockRate:   90000,
+					Control:     "trackID=1",
+					Framerate:   25,
+					Parameters: map[string]string{
+						"profile-level-id":     "420029",
+						"packetization-mode":   "1",
+						"sprop-parameter-sets": "Z00AKpY1QPAET8s3AQEBAg==,aO4xsg==",
+					},
+					Width:   1920,
+					Height:  1080,
+					Profile: "Main",
+					Level:   "4.2",
+				},
+				{
+					Media:       "audio",
+					Codec:       "G.711",
+					Encoding:    "PCMU",
+					PayloadType: 0,
+					ClockRate:   8000,
+					Control:     "trackID=2",
+					Framerate:   15,
+				},
+			},
+		},
+		{
+			description: "h265, mjpeg and aac",
+
+			sdp: "v=0\n" +
+				"m=video 0 RTP/AVP 98\n" +
+				"a=rtpmap:98 H265/90000\n" +
+				"a=control:rtsp://192.168.1.10/main/trackID=0\n" +
+				"m=video 0 RTP/AVP 26\n" +
+				"m=audio 0 RTP/AVP 97 0\n" +
+				"a=rtpmap:97 mpeg4-generic/16000/1\n" +
+				"a=rtpmap:0 PCMU/8000\n",
+
+			expectedTracks: []Track{
+				{
+					Media:       "video",
+					Codec:       "H.265",
+					Encoding:    "H265",
+					PayloadType: 98,
+					ClockRate:   90000,
+					Control:     "rtsp://192.168.1.10/main/trackID=0",
+				},
+				{
+					Media:       "video",
+					Codec:       "MJPEG",
+					Encoding:    "JPEG",
+					PayloadType: 26,
+					ClockRate:   90000,
+				},
+				{
+					Media:       "audio",
+					Codec:       "AAC",
+					Encoding:    "MPEG4-GENERIC",
+					PayloadType: 97,
+					ClockRate:   16000,
+				},
+			},
+		},
+		{
+			description: "unknown codec",
+
+			sdp: "m=application 0 RTP/AVP 107\na=rtpmap:107 vnd.onvif.metadata/90000\n",
+
+			expectedTracks: []Track{
+				{
+					Media:       "application",
+					Codec:       "VND.ONVIF.METADATA",
+					Encoding:    "VND.ONVIF.METADATA",
+					PayloadType: 107,
+					ClockRate:   90000,
+				},
+			},
+		},
+		{
+			description: "invalid media descriptions",
+
+			sdp: "m=video\na=rtpmap:96 H264/90000\nnot an sdp line",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Equal(t, test.expectedTracks, parseSDP(test.sdp))
+		})
+	}
+}
+
+func TestValidateCameraStreamsDescribesRoutes(t *testing.T) {
+	describe := fmt.Sprintf("RTSP/1.0 200 OK\r\nCSeq: %%s\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s", len(fakeSDP), fakeSDP)
+
+	server := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		if req.method == "DESCRIBE" {
+			return describe
+		}
+		return fakeOK
+	})
+	defer server.close()
+
+	scanner := &Scanner{
+		term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		curl:    NewRTSPClient(),
+		timeout: time.Second,
+	}
+
+	target := server.stream(t)
+	target.ValidRoutes = []ValidRoute{{Route: "live.sdp"}}
+
+	result := scanner.validateCameraStreams(context.Background(), target)
+
+	assert.True(t, result.ValidRoutes[0].Available)
+	assert.Equal(t, parseSDP(fakeSDP), result.ValidRoutes[0].Tracks)
+	assert.Len(t, result.ValidRoutes[0].Tracks, 2)
+}
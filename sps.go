@@ -0,0 +1,402 @@
+package cameradar
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Stream types of routes.
+const (
+	StreamTypeMain = "main"
+	StreamTypeSub  = "sub"
+)
+
+// videoFormat is what is known of a video from its sequence parameter set.
+type videoFormat struct {
+	width   int
+	height  int
+	profile string
+	level   string
+}
+
+var h264Profiles = map[int]string{
+	66:  "Baseline",
+	77:  "Main",
+	88:  "Extended",
+	100: "High",
+	110: "High 10",
+	122: "High 4:2:2",
+	244: "High 4:4:4 Predictive",
+}
+
+var h265Profiles = map[int]string{
+	1: "Main",
+	2: "Main 10",
+	3: "Main Still Picture",
+	4: "Range Extensions",
+}
+
+// decodeParameterSets fills the resolution, profile and level of the track
+// using the parameter sets advertised in its SDP format parameters.
+func (t *Track) decodeParameterSets() {
+	var (
+		format videoFormat
+		err    error
+	)
+
+	switch t.Codec {
+	case "H.264":
+		sets := strings.Split(t.Parameters["sprop-parameter-sets"], ",")
+		format, err = parseH264SPS(decodeParameterSet(sets[0]))
+	case "H.265":
+		sets := strings.Split(t.Parameters["sprop-sps"], ",")
+		format, err = parseH265SPS(decodeParameterSet(sets[0]))
+	default:
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	t.Width = format.width
+	t.Height = format.height
+	t.Profile = format.profile
+	t.Level = format.level
+}
+
+// decodeParameterSet decodes a base64 encoded parameter set, which some cameras
+// advertise without padding. It returns nil if the parameter set is invalid.
+func decodeParameterSet(set string) []byte {
+	data, err := base64.StdEncoding.DecodeString(set)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(set, "="))
+		if err != nil {
+			return nil
+		}
+	}
+	return data
+}
+
+// classifyStreams sets the stream type of the routes of the given stream which have a
+// known resolution. Routes with the highest resolution are main streams, and the other
+// ones are sub-streams.
+func classifyStreams(target Stream) Stream {
+	pixels := make([]int, len(target.ValidRoutes))
+	highest := 0
+	for i, route := range target.ValidRoutes {
+		for _, track := range route.Tracks {
+			if track.Width*track.Height > pixels[i] {
+				pixels[i] = track.Width * track.Height
+			}
+		}
+
+		if pixels[i] > highest {
+			highest = pixels[i]
+		}
+	}
+
+	for i := range target.ValidRoutes {
+		switch {
+		case pixels[i] == 0:
+			target.ValidRoutes[i].StreamType = ""
+		case pixels[i] == highest:
+			target.ValidRoutes[i].StreamType = StreamTypeMain
+		default:
+			target.ValidRoutes[i].StreamType = StreamTypeSub
+		}
+	}
+
+	return target
+}
+
+// parseH264SPS parses an H.264 sequence parameter set NAL unit, as specified
+// in section 7.3.2.1.1 of ITU-T H.264.
+func parseH264SPS(nal []byte) (videoFormat, error) {
+	if len(nal) < 4 || nal[0]&0x1f != 7 {
+		return videoFormat{}, errors.New("not an H.264 SPS")
+	}
+
+	r := &bitReader{data: removeEmulationPrevention(nal[1:])}
+
+	profileIdc := r.bits(8)
+	constraints := r.bits(8)
+	levelIdc := r.bits(8)
+	r.ue() // seq_parameter_set_id
+
+	chromaFormatIdc := 1
+	separateColourPlane := false
+	switch profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormatIdc = r.ue()
+		if chromaFormatIdc == 3 {
+			separateColourPlane = r.bit()
+		}
+		r.ue()       // bit_depth_luma_minus8
+		r.ue()       // bit_depth_chroma_minus8
+		r.bit()      // qpprime_y_zero_transform_bypass_flag
+		if r.bit() { // seq_scaling_matrix_present_flag
+			lists := 8
+			if chromaFormatIdc == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if !r.bit() {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				skipScalingList(r, size)
+			}
+		}
+	}
+
+	r.ue()          // log2_max_frame_num_minus4
+	switch r.ue() { // pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bit() // delta_pic_order_always_zero_flag
+		r.se()  // offset_for_non_ref_pic
+		r.se()  // offset_for_top_to_bottom_field
+		cycle := r.ue()
+		for i := 0; i < cycle && r.err == nil; i++ {
+			r.se() // offset_for_ref_frame
+		}
+	}
+
+	r.ue()  // max_num_ref_frames
+	r.bit() // gaps_in_frame_num_value_allowed_flag
+	widthInMbs := r.ue() + 1
+	heightInMapUnits := r.ue() + 1
+	frameMbsOnly := r.bit()
+	if !frameMbsOnly {
+		r.bit() // mb_adaptive_frame_field_flag
+	}
+	r.bit() // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.bit() { // frame_cropping_flag
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+
+	if r.err != nil {
+		return videoFormat{}, r.err
+	}
+
+	fieldFactor := 2
+	if frameMbsOnly {
+		fieldFactor = 1
+	}
+
+	cropUnitX, cropUnitY := 1, fieldFactor
+	if chromaFormatIdc != 0 && !separateColourPlane {
+		subWidth, subHeight := chromaSubsampling(chromaFormatIdc)
+		cropUnitX, cropUnitY = subWidth, subHeight*fieldFactor
+	}
+
+	profile := h264Profiles[profileIdc]
+	if profile == "" {
+		profile = fmt.Sprintf("%d", profileIdc)
+	}
+	// constraint_set1_flag
+	if profileIdc == 66 && constraints&0x40 != 0 {
+		profile = "Constrained Baseline"
+	}
+
+	return videoFormat{
+		width:   widthInMbs*16 - (cropLeft+cropRight)*cropUnitX,
+		height:  fieldFactor*heightInMapUnits*16 - (cropTop+cropBottom)*cropUnitY,
+		profile: profile,
+		level:   fmt.Sprintf("%d.%d", levelIdc/10, levelIdc%10),
+	}, nil
+}
+
+// parseH265SPS parses an H.265 sequence parameter set NAL unit, as specified
+// in section 7.3.2.2 of ITU-T H.265.
+func parseH265SPS(nal []byte) (videoFormat, error) {
+	if len(nal) < 3 || (nal[0]>>1)&0x3f != 33 {
+		return videoFormat{}, errors.New("not an H.265 SPS")
+	}
+
+	r := &bitReader{data: removeEmulationPrevention(nal[2:])}
+
+	r.bits(4) // sps_video_parameter_set_id
+	maxSubLayersMinus1 := r.bits(3)
+	r.bit() // sps_temporal_id_nesting_flag
+
+	// profile_tier_level
+	r.bits(2) // general_profile_space
+	r.bit()   // general_tier_flag
+	profileIdc := r.bits(5)
+	r.skip(32) // general_profile_compatibility_flags
+	r.skip(48) // general constraint flags
+	levelIdc := r.bits(8)
+
+	profilePresent := make([]bool, maxSubLayersMinus1)
+	levelPresent := make([]bool, maxSubLayersMinus1)
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		profilePresent[i] = r.bit()
+		levelPresent[i] = r.bit()
+	}
+	if maxSubLayersMinus1 > 0 {
+		r.skip(2 * (8 - maxSubLayersMinus1))
+	}
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if profilePresent[i] {
+			r.skip(88)
+		}
+		if levelPresent[i] {
+			r.skip(8)
+		}
+	}
+
+	r.ue() // sps_seq_parameter_set_id
+	chromaFormatIdc := r.ue()
+	separateColourPlane := false
+	if chromaFormatIdc == 3 {
+		separateColourPlane = r.bit()
+	}
+	width := r.ue()
+	height := r.ue()
+
+	if r.bit() { // conformance_window_flag
+		subWidth, subHeight := 1, 1
+		if chromaFormatIdc != 0 && !separateColourPlane {
+			subWidth, subHeight = chromaSubsampling(chromaFormatIdc)
+		}
+
+		left, right, top, bottom := r.ue(), r.ue(), r.ue(), r.ue()
+		width -= (left + right) * subWidth
+		height -= (top + bottom) * subHeight
+	}
+
+	if r.err != nil {
+		return videoFormat{}, r.err
+	}
+
+	profile := h265Profiles[profileIdc]
+	if profile == "" {
+		profile = fmt.Sprintf("%d", profileIdc)
+	}
+
+	// general_level_idc is 30 times the level number.
+	level := fmt.Sprintf("%d", levelIdc/30)
+	if levelIdc%30 != 0 {
+		level = fmt.Sprintf("%d.%d", levelIdc/30, levelIdc%30/3)
+	}
+
+	return videoFormat{
+		width:   width,
+		height:  height,
+		profile: profile,
+		level:   level,
+	}, nil
+}
+
+// chromaSubsampling returns the horizontal and vertical chroma subsampling
+// factors of the given chroma format.
+func chromaSubsampling(chromaFormatIdc int) (int, int) {
+	switch chromaFormatIdc {
+	case 1:
+		return 2, 2
+	case 2:
+		return 2, 1
+	default:
+		return 1, 1
+	}
+}
+
+func skipScalingList(r *bitReader, size int) {
+	last, next := 8, 8
+	for i := 0; i < size && r.err == nil; i++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// removeEmulationPrevention removes the emulation prevention bytes of a NAL unit.
+func removeEmulationPrevention(data []byte) []byte {
+	result := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+// bitReader reads the bits of a NAL unit. Once the end of the data is reached,
+// all reads return zero and err is set.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) bit() bool {
+	return r.bits(1) == 1
+}
+
+func (r *bitReader) bits(n int) int {
+	value := 0
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errors.New("unexpected end of parameter set")
+			return 0
+		}
+
+		value <<= 1
+		value |= int(r.data[r.pos/8]>>(7-uint(r.pos%8))) & 1
+		r.pos++
+	}
+	return value
+}
+
+func (r *bitReader) skip(n int) {
+	if r.pos+n > len(r.data)*8 {
+		r.err = errors.New("unexpected end of parameter set")
+		r.pos = len(r.data) * 8
+		return
+	}
+	r.pos += n
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() int {
+	leadingZeros := 0
+	for !r.bit() {
+		if r.err != nil || leadingZeros > 31 {
+			r.err = errors.New("invalid Exp-Golomb code")
+			return 0
+		}
+		leadingZeros++
+	}
+	return (1 << uint(leadingZeros)) - 1 + r.bits(leadingZeros)
+}
+
+// se reads a signed Exp-Golomb code.
+func (r *bitReader) se() int {
+	value := r.ue()
+	if value%2 == 0 {
+		return -value / 2
+	}
+	return (value + 1) / 2
+}
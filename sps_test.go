@@ -0,0 +1,150 @@
+package cameradar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeParameterSets(t *testing.T) {
+	tests := []struct {
+		description string
+
+		track Track
+
+		expectedWidth   int
+		expectedHeight  int
+		expectedProfile string
+		expectedLevel   string
+	}{
+		{
+			description: "h264 high profile with cropping",
+
+			track: Track{
+				Codec:      "H.264",
+				Parameters: map[string]string{"sprop-parameter-sets": "Z2QAKKzaAeAIn5U=,aO48gA=="},
+			},
+
+			expectedWidth:   1920,
+			expectedHeight:  1080,
+			expectedProfile: "High",
+			expectedLevel:   "4.0",
+		},
+		{
+			description: "h264 constrained baseline profile without padding",
+
+			track: Track{
+				Codec:      "H.264",
+				Parameters: map[string]string{"sprop-parameter-sets": "Z0LAHu0BQF/yoA"},
+			},
+
+			expectedWidth:   640,
+			expectedHeight:  360,
+			expectedProfile: "Constrained Baseline",
+			expectedLevel:   "3.0",
+		},
+		{
+			description: "h265 main profile",
+
+			track: Track{
+				Codec: "H.265",
+				Parameters: map[string]string{
+					"sprop-vps": "QAEMAf//AWAAAAMAkAAAAwAAAwCZmZgJ",
+					"sprop-sps": "QgEBAUAAAAMAkAAAAwAAAwCZoAHgIAIcWWA=",
+					"sprop-pps": "RAHA8vA8kAA=",
+				},
+			},
+
+			expectedWidth:   3840,
+			expectedHeight:  2160,
+			expectedProfile: "Main",
+			expectedLevel:   "5.1",
+		},
+		{
+			description: "h265 main 10 profile with conformance window",
+
+			track: Track{
+				Codec:      "H.265",
+				Parameters: map[string]string{"sprop-sps": "QgEBAiAAAAMAkAAAAwAAAwB4oAPAgBEHy5Y="},
+			},
+
+			expectedWidth:   1920,
+			expectedHeight:  1080,
+			expectedProfile: "Main 10",
+			expectedLevel:   "4",
+		},
+		{
+			description: "truncated sps",
+
+			track: Track{
+				Codec:      "H.264",
+				Parameters: map[string]string{"sprop-parameter-sets": "Z2QAKKza"},
+			},
+		},
+		{
+			description: "not an sps",
+
+			track: Track{
+				Codec:      "H.264",
+				Parameters: map[string]string{"sprop-parameter-sets": "aO48gA=="},
+			},
+		},
+		{
+			description: "invalid base64",
+
+			track: Track{
+				Codec:      "H.265",
+				Parameters: map[string]string{"sprop-sps": "!!!"},
+			},
+		},
+		{
+			description: "no parameter sets",
+
+			track: Track{
+				Codec: "H.264",
+			},
+		},
+		{
+			description: "other codec",
+
+			track: Track{
+				Codec:      "MJPEG",
+				Parameters: map[string]string{"sprop-parameter-sets": "Z2QAKKzaAeAIn5U="},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			track := test.track
+			track.decodeParameterSets()
+
+			assert.Equal(t, test.expectedWidth, track.Width)
+			assert.Equal(t, test.expectedHeight, track.Height)
+			assert.Equal(t, test.expectedProfile, track.Profile)
+			assert.Equal(t, test.expectedLevel, track.Level)
+		})
+	}
+}
+
+func TestRemoveEmulationPrevention(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 1, 0, 0, 0, 0, 0, 3}, removeEmulationPrevention([]byte{0, 0, 3, 1, 0, 0, 3, 0, 0, 0, 3, 3}))
+}
+
+func TestClassifyStreams(t *testing.T) {
+	target := Stream{
+		ValidRoutes: []ValidRoute{
+			{Route: "sub", Tracks: []Track{{Media: "video", Width: 640, Height: 360}, {Media: "audio"}}},
+			{Route: "unknown"},
+			{Route: "main", Tracks: []Track{{Media: "video", Width: 3840, Height: 2160}}},
+			{Route: "main-copy", Tracks: []Track{{Media: "video", Width: 3840, Height: 2160}}},
+		},
+	}
+
+	result := classifyStreams(target)
+
+	assert.Equal(t, StreamTypeSub, result.ValidRoutes[0].StreamType)
+	assert.Equal(t, "", result.ValidRoutes[1].StreamType)
+	assert.Equal(t, StreamTypeMain, result.ValidRoutes[2].StreamType)
+	assert.Equal(t, StreamTypeMain, result.ValidRoutes[3].StreamType)
+}
@@ -3,13 +3,12 @@ package cameradar
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Ullaakut/disgo/style"
-	curl "github.com/Ullaakut/go-curl"
 )
 
-
-
 // PrintStreams prints information on each stream.
 func (s *Scanner) PrintStreams(streams []Stream) {
 	if len(streams) == 0 {
@@ -20,11 +19,10 @@ func (s *Scanner) PrintStreams(streams []Stream) {
 	streams_marshalled, err := json.MarshalIndent(streams, "", "	")
 	if err != nil {
 		fmt.Printf("Error: %s", err)
-		return;
+		return
 	}
 	fmt.Printf(string(streams_marshalled))
 
-
 	success := 0
 	for _, stream := range streams {
 
@@ -34,29 +32,79 @@ func (s *Scanner) PrintStreams(streams []Stream) {
 
 		s.term.Infof("\tIP address:\t\t%s\n", stream.Address)
 		s.term.Infof("\tRTSP port:\t\t%d\n", stream.Port)
+		if stream.MACAddress != "" {
+			s.term.Infof("\tMAC address:\t\t%s\n", stream.MACAddress)
+		}
+		if stream.HardwareVendor != "" {
+			s.term.Infof("\tHardware vendor:\t%s\n", stream.HardwareVendor)
+		}
+		if stream.TLS {
+			s.term.Infoln("\tThis camera uses RTSP over TLS")
+		}
+		if stream.HTTPTunnel {
+			s.term.Infoln("\tThis camera is reached by tunneling RTSP in HTTP, which its URLs must be played with")
+		}
+		for _, xaddr := range stream.XAddrs {
+			s.term.Infof("\tONVIF service:\t\t%s\n", style.Link(xaddr))
+		}
+		if stream.ONVIF != nil {
+			s.printONVIFDevice(*stream.ONVIF)
+		}
+		if stream.Certificate != nil {
+			s.term.Infof("\tCertificate subject:\t%s\n", stream.Certificate.Subject)
+			s.term.Infof("\tCertificate issuer:\t%s\n", stream.Certificate.Issuer)
+			s.term.Infof("\tCertificate expiry:\t%s\n", stream.Certificate.NotAfter.Format(time.RFC3339))
+		}
 
-		switch stream.AuthenticationType {
-		case curl.AUTH_NONE:
-			s.term.Infoln("\tThis camera does not require authentication")
-		case curl.AUTH_BASIC:
-			s.term.Infoln("\tAuth type:\t\tbasic")
-		case curl.AUTH_DIGEST:
-			s.term.Infoln("\tAuth type:\t\tdigest")
+		// Streams whose routes were found have the authentication method of each
+		// route printed instead.
+		if len(stream.ValidRoutes) == 0 {
+			if stream.AuthenticationType == authNone && len(stream.AuthenticationSchemes) == 0 {
+				s.term.Infoln("\tThis camera does not require authentication")
+			} else {
+				s.printAuthentication("\t", stream.AuthenticationType, stream.AuthenticationSchemes)
+			}
 		}
 
+		if stream.RouteBehavior == RouteBehaviorAcceptAll {
+			s.term.Infoln("\tThis camera accepts any route")
+		}
 
 		if len(stream.ValidRoutes) > 0 {
 			for _, route := range stream.ValidRoutes {
 				s.term.Infof("\tRTSP route:\t\t%s\n", style.Success("/"+route.Route))
+				if route.StreamType != "" {
+					s.term.Infof("\t\tStream type:\t\t%s\n", route.StreamType)
+				}
+				if route.ONVIF {
+					s.term.Infoln("\t\tThis route was retrieved through ONVIF")
+				}
+				if route.Channel != 0 {
+					s.term.Infof("\t\tChannel:\t\t%d\n", route.Channel)
+				}
+				if route.Transport != "" {
+					s.term.Infof("\t\tTransport:\t\t%s\n", strings.ToUpper(route.Transport))
+				}
+				if route.PacketsReceived > 0 {
+					s.term.Infof("\t\tPackets received:\t%d (first after %s)\n", route.PacketsReceived, route.FirstPacketLatency)
+				}
+				for _, track := range route.Tracks {
+					s.term.Infof("\t\tTrack:\t\t\t%s\n", trackDescription(track))
+				}
+				if route.AuthenticationType == authNone && len(route.AuthenticationSchemes) == 0 {
+					s.term.Infoln("\t\tThis route does not require authentication")
+				} else {
+					s.printAuthentication("\t\t", route.AuthenticationType, route.AuthenticationSchemes)
+				}
 				if route.CredentialsFound {
-					s.term.Infof("\t\tUsername:\t\t%s\n", style.Success(stream.Username))
-					s.term.Infof("\t\tPassword:\t\t%s\n", style.Success(stream.Password))
+					s.term.Infof("\t\tUsername:\t\t%s\n", style.Success(route.Username))
+					s.term.Infof("\t\tPassword:\t\t%s\n", style.Success(route.Password))
 				} else {
 					s.term.Infof("\t\tUsername:\t\t%s\n", style.Failure("not found"))
 					s.term.Infof("\t\tPassword:\t\t%s\n", style.Failure("not found"))
 				}
 				if route.Available {
-					s.term.Infof("%s\tDevice RTSP URL:\t%s\n", style.Success(style.SymbolRightTriangle), style.Link(GetCameraRTSPURL(stream)+route.Route))
+					s.term.Infof("%s\tDevice RTSP URL:\t%s\n", style.Success(style.SymbolRightTriangle), style.Link(GetRouteRTSPURL(stream, route)))
 					s.term.Infof("\tAvailable:\t\t%s\n", style.Success(style.SymbolCheck))
 					success++
 				} else {
@@ -68,6 +116,7 @@ func (s *Scanner) PrintStreams(streams []Stream) {
 			s.term.Infof("\tRTSP route:\t\t%s\n\n\n", style.Failure("not found"))
 			s.term.Infof("\t\tUsername:\t\t%s\n", style.Failure("not found"))
 			s.term.Infof("\t\tPassword:\t\t%s\n", style.Failure("not found"))
+			s.term.Infof("\tAdmin panel URL:\t%s You can use this URL to try attacking the camera's admin panel instead.\n", style.Link(GetCameraAdminPanelURL(stream)))
 		}
 	}
 
@@ -79,3 +128,88 @@ func (s *Scanner) PrintStreams(streams []Stream) {
 		s.term.Infof("%s Streams were found but none were accessed. They are most likely configured with secure credentials and routes. You can try adding entries to the dictionary or generating your own in order to attempt a bruteforce attack on the cameras.\n", style.Failure("\xE2\x9C\x96"))
 	}
 }
+
+// printAuthentication prints the authentication method used to attack a stream or
+// route, followed by all the schemes it offers.
+func (s *Scanner) printAuthentication(indent string, authType int, schemes []AuthenticationScheme) {
+	s.term.Infof("%sAuth type:\t\t%s\n", indent, authMethodName(authType))
+
+	var offered []string
+	for _, scheme := range schemes {
+		if scheme.Realm == "" {
+			offered = append(offered, scheme.Scheme)
+			continue
+		}
+		offered = append(offered, fmt.Sprintf("%s (realm %q)", scheme.Scheme, scheme.Realm))
+	}
+	if len(offered) > 0 {
+		s.term.Infof("%sAuth schemes:\t\t%s\n", indent, strings.Join(offered, ", "))
+	}
+}
+
+// printONVIFDevice prints the credentials, device information and capabilities
+// of the ONVIF device service of a camera.
+func (s *Scanner) printONVIFDevice(device ONVIFDevice) {
+	s.term.Infof("\tONVIF username:\t\t%s\n", style.Success(device.Username))
+	s.term.Infof("\tONVIF password:\t\t%s\n", style.Success(device.Password))
+
+	if device.Manufacturer != "" {
+		s.term.Infof("\tManufacturer:\t\t%s\n", device.Manufacturer)
+	}
+	if device.Model != "" {
+		s.term.Infof("\tModel:\t\t\t%s\n", device.Model)
+	}
+	if device.FirmwareVersion != "" {
+		s.term.Infof("\tFirmware version:\t%s\n", device.FirmwareVersion)
+	}
+	if device.SerialNumber != "" {
+		s.term.Infof("\tSerial number:\t\t%s\n", device.SerialNumber)
+	}
+	if device.HardwareID != "" {
+		s.term.Infof("\tHardware ID:\t\t%s\n", device.HardwareID)
+	}
+
+	var capabilities []string
+	if device.PTZ {
+		capabilities = append(capabilities, "PTZ")
+	}
+	if device.Audio {
+		capabilities = append(capabilities, "audio")
+	}
+	if device.Analytics {
+		capabilities = append(capabilities, "analytics")
+	}
+	if device.Backchannel {
+		capabilities = append(capabilities, "audio backchannel")
+	}
+	if len(capabilities) > 0 {
+		s.term.Infof("\tCapabilities:\t\t%s\n", strings.Join(capabilities, ", "))
+	}
+	if len(device.Services) > 0 {
+		s.term.Infof("\tONVIF services:\t\t%s\n", strings.Join(device.Services, ", "))
+	}
+}
+
+// trackDescription returns a human-readable description of a media track.
+func trackDescription(track Track) string {
+	codec := track.Codec
+	if codec == "" {
+		codec = "unknown codec"
+	}
+
+	description := fmt.Sprintf("%s %s (payload type %d)", track.Media, codec, track.PayloadType)
+	if track.Width > 0 && track.Height > 0 {
+		description += fmt.Sprintf(", %dx%d", track.Width, track.Height)
+	}
+	if track.Profile != "" {
+		description += fmt.Sprintf(", %s profile level %s", track.Profile, track.Level)
+	}
+	if track.Framerate > 0 {
+		description += fmt.Sprintf(", %g fps", track.Framerate)
+	}
+	if track.Control != "" {
+		description += fmt.Sprintf(", control %s", track.Control)
+	}
+
+	return description
+}
@@ -2,7 +2,9 @@ package cameradar
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/Ullaakut/disgo"
 	"github.com/stretchr/testify/assert"
@@ -12,7 +14,9 @@ var (
 	unavailable = Stream{}
 
 	available = Stream{
-		Available: true,
+		ValidRoutes: []ValidRoute{
+			{Route: "r0ute", Available: true},
+		},
 	}
 
 	deviceFound = Stream{
@@ -31,15 +35,70 @@ var (
 		AuthenticationType: 2,
 	}
 
+	unknownAuth = Stream{
+		AuthenticationType: authUnknown,
+	}
+
+	schemesFound = Stream{
+		ValidRoutes: []ValidRoute{
+			{
+				Route:              "r0ute",
+				AuthenticationType: authDigest,
+				AuthenticationSchemes: []AuthenticationScheme{
+					{Scheme: "basic", Realm: "IP Camera"},
+					{Scheme: "digest", Realm: "IP Camera"},
+				},
+			},
+		},
+	}
+
 	credsFound = Stream{
-		CredentialsFound: true,
-		Username:         "us3r",
-		Password:         "p4ss",
+		ValidRoutes: []ValidRoute{
+			{Route: "r0ute", CredentialsFound: true, Username: "us3r", Password: "p4ss"},
+		},
 	}
 
 	routeFound = Stream{
-		RouteFound: true,
-		Route:      "r0ute",
+		ValidRoutes: []ValidRoute{
+			{Route: "r0ute"},
+		},
+	}
+
+	tracksFound = Stream{
+		ValidRoutes: []ValidRoute{
+			{
+				Route:      "r0ute",
+				Available:  true,
+				StreamType: StreamTypeMain,
+				Transport:  TransportTCP,
+				Tracks: []Track{
+					{Media: "video", Codec: "H.264", PayloadType: 96, Width: 1920, Height: 1080, Profile: "High", Level: "4.0", Framerate: 25, Control: "trackID=1"},
+				},
+			},
+		},
+	}
+
+	tlsStream = Stream{
+		TLS: true,
+		Certificate: &Certificate{
+			Subject:  "CN=fake camera",
+			Issuer:   "CN=fake CA",
+			NotAfter: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}
+
+	onvifStream = Stream{
+		XAddrs: []string{"http://192.168.1.10/onvif/device_service"},
+		ONVIF: &ONVIFDevice{
+			URL:             "http://192.168.1.10/onvif/device_service",
+			Username:        "admin",
+			Manufacturer:    "HIKVISION",
+			FirmwareVersion: "V5.4.5 build 170124",
+			SerialNumber:    "DS-2CD2032-I20170301AAWR123456789",
+			PTZ:             true,
+			Backchannel:     true,
+			Services:        []string{"http://www.onvif.org/ver10/device/wsdl", "http://www.onvif.org/ver20/ptz/wsdl"},
+		},
 	}
 )
 
@@ -85,6 +144,37 @@ func TestPrintStreams(t *testing.T) {
 
 			expectedLogs: []string{"This camera does not require authentication"},
 		},
+		{
+			description: "displays TLS certificate",
+
+			streams: []Stream{
+				tlsStream,
+			},
+
+			expectedLogs: []string{
+				"This camera uses RTSP over TLS",
+				"CN=fake camera",
+				"CN=fake CA",
+				"2030-01-02T03:04:05Z",
+			},
+		},
+		{
+			description: "displays ONVIF services",
+
+			streams: []Stream{
+				onvifStream,
+			},
+
+			expectedLogs: []string{
+				"http://192.168.1.10/onvif/device_service",
+				"ONVIF username:",
+				"HIKVISION",
+				"V5.4.5 build 170124",
+				"DS-2CD2032-I20170301AAWR123456789",
+				"PTZ, audio backchannel",
+				"http://www.onvif.org/ver10/device/wsdl, http://www.onvif.org/ver20/ptz/wsdl",
+			},
+		},
 		{
 			description: "displays authentication type (basic)",
 
@@ -103,6 +193,27 @@ func TestPrintStreams(t *testing.T) {
 
 			expectedLogs: []string{"digest"},
 		},
+		{
+			description: "displays authentication type (unknown)",
+
+			streams: []Stream{
+				unknownAuth,
+			},
+
+			expectedLogs: []string{"unknown"},
+		},
+		{
+			description: "displays every authentication scheme",
+
+			streams: []Stream{
+				schemesFound,
+			},
+
+			expectedLogs: []string{
+				"digest",
+				`basic (realm "IP Camera"), digest (realm "IP Camera")`,
+			},
+		},
 		{
 			description: "displays credentials properly",
 
@@ -129,6 +240,20 @@ func TestPrintStreams(t *testing.T) {
 				"/r0ute",
 			},
 		},
+		{
+			description: "displays tracks properly",
+
+			streams: []Stream{
+				tracksFound,
+			},
+
+			expectedLogs: []string{
+				"Track",
+				"video H.264 (payload type 96), 1920x1080, High profile level 4.0, 25 fps, control trackID=1",
+				"Stream type",
+				"Transport:\t\tTCP",
+			},
+		},
 		{
 			description: "displays successes properly (no success)",
 
@@ -184,3 +309,64 @@ func TestPrintStreams(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamJSON(t *testing.T) {
+	tests := []struct {
+		description string
+
+		authType int
+
+		expectedMethod string
+		expectedType   interface{}
+	}{
+		{
+			description: "no authentication",
+
+			authType: authNone,
+
+			expectedMethod: "none",
+			expectedType:   float64(authNone),
+		},
+		{
+			description: "digest authentication",
+
+			authType: authDigest,
+
+			expectedMethod: "digest",
+			expectedType:   float64(authDigest),
+		},
+		{
+			description: "unknown authentication",
+
+			authType: authUnknown,
+
+			expectedMethod: "unknown",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			stream := Stream{
+				Address:            "192.168.0.10",
+				Port:               554,
+				AuthenticationType: test.authType,
+				ValidRoutes:        []ValidRoute{{Route: "live.sdp", AuthenticationType: test.authType}},
+			}
+
+			content, err := json.Marshal(stream)
+			assert.NoError(t, err)
+
+			var output map[string]interface{}
+			assert.NoError(t, json.Unmarshal(content, &output))
+
+			assert.Equal(t, test.expectedMethod, output["authentication_method"])
+			assert.Equal(t, test.expectedType, output["authentication_type"])
+			assert.Equal(t, "192.168.0.10", output["address"])
+
+			route := output["route"].([]interface{})[0].(map[string]interface{})
+			assert.Equal(t, test.expectedMethod, route["authenticationMethod"])
+			assert.Equal(t, test.expectedType, route["authenticationType"])
+			assert.Equal(t, "live.sdp", route["routes"])
+		})
+	}
+}
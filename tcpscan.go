@@ -0,0 +1,446 @@
+package cameradar
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ullaakut/nmap"
+)
+
+const (
+	defaultConnectTimeout = 2 * time.Second
+
+	// maxHostBits is the maximum amount of host bits of the subnets and ranges that
+	// are scanned, which is 65536 addresses, such as a /16 IPv4 subnet or a /112 IPv6
+	// one. Larger networks take too long to scan one connection at a time.
+	maxHostBits = 16
+)
+
+// connectDelays are the delays between two connections of the connect scanner
+// for each scan speed. The slowest ones are the same as the ones of nmap's timing
+// templates, while faster ones limit the rate of connections less and less, up to
+// the fastest speed which does not limit it at all.
+var connectDelays = []time.Duration{
+	0: 5 * time.Minute,
+	1: 15 * time.Second,
+	2: 400 * time.Millisecond,
+	3: 10 * time.Millisecond,
+	4: time.Millisecond,
+	5: 0,
+}
+
+// connectDelay returns the delay between two connections for the given scan speed.
+// Speeds out of range are treated as the closest valid one.
+func connectDelay(speed int) time.Duration {
+	switch {
+	case speed < 0:
+		speed = 0
+	case speed >= len(connectDelays):
+		speed = len(connectDelays) - 1
+	}
+	return connectDelays[speed]
+}
+
+// connectScanner is a network scanner which requires neither nmap nor root
+// privileges. It connects to each port of the targets and sends an OPTIONS
+// request to the open ones in order to find out whether they serve RTSP. Its
+// results are the same as the ones of nmap, so that they are parsed the same way.
+type connectScanner struct {
+	ctx     context.Context
+	targets []string
+	ports   []string
+	timeout time.Duration
+	workers int
+	delay   time.Duration
+}
+
+// connectProbe is a port to probe on a host. The index of the host is the
+// order in which it was found in the targets.
+type connectProbe struct {
+	host    int
+	address string
+	port    uint16
+}
+
+func (s *Scanner) newConnectScanner(ctx context.Context) *connectScanner {
+	timeout := s.timeout
+	if timeout == 0 {
+		timeout = defaultConnectTimeout
+	}
+
+	workers := s.maxConcurrency
+	if workers <= 0 {
+		workers = defaultMaxConcurrency
+	}
+
+	return &connectScanner{
+		ctx:     ctx,
+		targets: s.targets,
+		ports:   s.ports,
+		timeout: timeout,
+		workers: workers,
+		delay:   connectDelay(s.scanSpeed),
+	}
+}
+
+// Run scans the targets and returns their open ports like nmap would. Targets
+// that can not be parsed or resolved are reported as warnings.
+func (c *connectScanner) Run() (*nmap.Run, []string, error) {
+	ports, err := parsePorts(c.ports)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		mutex    sync.Mutex
+		hosts    = make(map[int]*nmap.Host)
+		warnings []string
+	)
+
+	probes := make(chan connectProbe)
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for probe := range probes {
+				service, server, open := c.probe(probe.address, probe.port)
+				if !open {
+					continue
+				}
+
+				mutex.Lock()
+				host, ok := hosts[probe.host]
+				if !ok {
+					host = &nmap.Host{
+						Addresses: []nmap.Address{{Addr: probe.address, AddrType: addressType(probe.address)}},
+					}
+					hosts[probe.host] = host
+				}
+				host.Ports = append(host.Ports, nmap.Port{
+					ID:       probe.port,
+					Protocol: "tcp",
+					State:    nmap.State{State: "open"},
+					Service:  nmap.Service{Name: service, Product: server, Method: "probed"},
+				})
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	var throttle <-chan time.Time
+	if c.delay > 0 {
+		ticker := time.NewTicker(c.delay)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	hostIndex := 0
+	first := true
+	send := func(address string) bool {
+		for _, port := range ports {
+			if throttle != nil && !first {
+				select {
+				case <-throttle:
+				case <-c.ctx.Done():
+					return false
+				}
+			}
+
+			first = false
+
+			select {
+			case probes <- connectProbe{host: hostIndex, address: address, port: port}:
+			case <-c.ctx.Done():
+				return false
+			}
+		}
+		hostIndex++
+		return true
+	}
+
+	for _, target := range c.targets {
+		err := c.expandTarget(target, send)
+		if err != nil {
+			warnings = append(warnings, err.Error())
+		}
+		if c.ctx.Err() != nil {
+			break
+		}
+	}
+
+	close(probes)
+	wg.Wait()
+
+	if c.ctx.Err() != nil {
+		return nil, warnings, c.ctx.Err()
+	}
+
+	run := &nmap.Run{}
+	indexes := make([]int, 0, len(hosts))
+	for index := range hosts {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		host := hosts[index]
+		sort.Slice(host.Ports, func(i, j int) bool {
+			return host.Ports[i].ID < host.Ports[j].ID
+		})
+		run.Hosts = append(run.Hosts, *host)
+	}
+
+	return run, warnings, nil
+}
+
+// probe connects to the given port and, if it is open, sends it an OPTIONS request.
+func (c *connectScanner) probe(address string, port uint16) (string, string, bool) {
+	return probeService(c.ctx, address, port, c.timeout)
+}
+
+// probeService connects to the given port and, if it is open, sends it an RTSP
+// OPTIONS request. It returns the name of the service found on the port, which is
+// empty if it is neither RTSP nor HTTP, and the Server header of its response.
+func probeService(ctx context.Context, address string, port uint16, timeout time.Duration) (string, string, bool) {
+	target := net.JoinHostPort(address, strconv.Itoa(int(port)))
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return "", "", false
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return "", "", true
+	}
+
+	_, err = fmt.Fprintf(conn, "OPTIONS rtsp://%s/ RTSP/1.0\r\nCSeq: 1\r\nUser-Agent: %s\r\n\r\n", target, rtspUserAgent)
+	if err != nil {
+		return "", "", true
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	line, err := reader.ReadLine()
+	if err != nil {
+		return "", "", true
+	}
+
+	var service string
+	switch {
+	case strings.HasPrefix(line, "RTSP/1.0 "):
+		service = "rtsp"
+	case strings.HasPrefix(line, "HTTP/1."):
+		service = "http"
+	default:
+		return "", "", true
+	}
+
+	// The headers are only used to find the model of the device.
+	header, _ := reader.ReadMIMEHeader()
+
+	return service, header.Get("Server"), true
+}
+
+// expandTarget calls send with each address of the given target, until send
+// returns false. Targets can be IP addresses, subnets, IPv4 ranges such as
+// 172.16.100.10-20 or hostnames, which are resolved to their first address.
+func (c *connectScanner) expandTarget(target string, send func(address string) bool) error {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil
+	}
+
+	if ip := net.ParseIP(target); ip != nil {
+		send(ip.String())
+		return nil
+	}
+
+	if strings.Contains(target, "/") {
+		return expandSubnet(target, send)
+	}
+
+	if octets, ok := parseIPv4Range(target); ok {
+		size := 1
+		for _, values := range octets {
+			size *= len(values)
+		}
+		if size > 1<<maxHostBits {
+			return fmt.Errorf("range %q has more than %d addresses", target, 1<<maxHostBits)
+		}
+
+		expandIPv4Range(octets, nil, send)
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(c.ctx, target)
+	if err != nil || len(addresses) == 0 {
+		return fmt.Errorf("failed to resolve %q", target)
+	}
+
+	send(addresses[0].IP.String())
+	return nil
+}
+
+// expandSubnet calls send with each address of the given subnet.
+func expandSubnet(subnet string, send func(address string) bool) error {
+	ip, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %q: %v", subnet, err)
+	}
+
+	ones, bits := network.Mask.Size()
+	if bits-ones > maxHostBits {
+		return fmt.Errorf("subnet %q has more than %d addresses", subnet, 1<<maxHostBits)
+	}
+
+	ip = network.IP
+	for i := uint64(0); i < uint64(1)<<uint(bits-ones); i++ {
+		if !send(ip.String()) {
+			return nil
+		}
+		ip = nextIP(ip)
+	}
+
+	return nil
+}
+
+// nextIP returns the address following the given one.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// parseIPv4Range parses an IPv4 range in which each octet can be a number,
+// a range of numbers such as 10-20, a list of those or *, like nmap.
+func parseIPv4Range(target string) ([][]int, bool) {
+	parts := strings.Split(target, ".")
+	if len(parts) != 4 {
+		return nil, false
+	}
+
+	octets := make([][]int, 4)
+	for i, part := range parts {
+		values, err := parseOctet(part)
+		if err != nil {
+			return nil, false
+		}
+		octets[i] = values
+	}
+
+	return octets, true
+}
+
+func parseOctet(part string) ([]int, error) {
+	if part == "*" {
+		part = "0-255"
+	}
+
+	var values []int
+	for _, item := range strings.Split(part, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if first < 0 || last > 255 || first > last {
+			return nil, errors.New("invalid octet range")
+		}
+
+		for value := first; value <= last; value++ {
+			values = append(values, value)
+		}
+	}
+
+	return values, nil
+}
+
+// expandIPv4Range calls send with each address of the given range, and returns
+// whether the range was entirely expanded.
+func expandIPv4Range(octets [][]int, prefix []string, send func(address string) bool) bool {
+	if len(prefix) == len(octets) {
+		return send(strings.Join(prefix, "."))
+	}
+
+	for _, value := range octets[len(prefix)] {
+		if !expandIPv4Range(octets, append(prefix, strconv.Itoa(value)), send) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parsePorts parses port specifications such as 554,8554-8560 into a sorted
+// list of unique ports.
+func parsePorts(specs []string) ([]uint16, error) {
+	seen := make(map[uint16]bool)
+	var ports []uint16
+	for _, spec := range specs {
+		for _, item := range strings.Split(spec, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			bounds := strings.SplitN(item, "-", 2)
+			first, err := strconv.ParseUint(bounds[0], 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port %q", item)
+			}
+			last := first
+			if len(bounds) == 2 {
+				last, err = strconv.ParseUint(bounds[1], 10, 16)
+				if err != nil || last < first {
+					return nil, fmt.Errorf("invalid port range %q", item)
+				}
+			}
+
+			for port := first; port <= last; port++ {
+				if !seen[uint16(port)] {
+					seen[uint16(port)] = true
+					ports = append(ports, uint16(port))
+				}
+			}
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i] < ports[j]
+	})
+
+	return ports, nil
+}
+
+func addressType(address string) string {
+	if isIPv6(address) {
+		return "ipv6"
+	}
+	return "ipv4"
+}
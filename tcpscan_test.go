@@ -0,0 +1,287 @@
+package cameradar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		description string
+
+		specs []string
+
+		expectedPorts []uint16
+		expectedErr   error
+	}{
+		{
+			description: "ports and ranges",
+
+			specs: []string{"8554-8556,554", "554"},
+
+			expectedPorts: []uint16{554, 8554, 8555, 8556},
+		},
+		{
+			description: "invalid port",
+
+			specs: []string{"rtsp"},
+
+			expectedErr: errors.New(`invalid port "rtsp"`),
+		},
+		{
+			description: "invalid range",
+
+			specs: []string{"8556-8554"},
+
+			expectedErr: errors.New(`invalid port range "8556-8554"`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			ports, err := parsePorts(test.specs)
+
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.expectedPorts, ports)
+		})
+	}
+}
+
+func TestExpandTarget(t *testing.T) {
+	tests := []struct {
+		description string
+
+		target string
+
+		expectedAddresses []string
+		expectedErr       error
+	}{
+		{
+			description: "ip address",
+
+			target: "172.16.100.10",
+
+			expectedAddresses: []string{"172.16.100.10"},
+		},
+		{
+			description: "subnet",
+
+			target: "172.16.100.0/30",
+
+			expectedAddresses: []string{"172.16.100.0", "172.16.100.1", "172.16.100.2", "172.16.100.3"},
+		},
+		{
+			description: "ipv6 subnet",
+
+			target: "fd00::/126",
+
+			expectedAddresses: []string{"fd00::", "fd00::1", "fd00::2", "fd00::3"},
+		},
+		{
+			description: "range",
+
+			target: "172.16.100.10-12",
+
+			expectedAddresses: []string{"172.16.100.10", "172.16.100.11", "172.16.100.12"},
+		},
+		{
+			description: "range in several octets",
+
+			target: "172.16.1-2.1,3",
+
+			expectedAddresses: []string{"172.16.1.1", "172.16.1.3", "172.16.2.1", "172.16.2.3"},
+		},
+		{
+			description: "hostname",
+
+			target: "localhost",
+
+			expectedAddresses: []string{"127.0.0.1"},
+		},
+		{
+			description: "invalid subnet",
+
+			target: "172.16.100.0/33",
+
+			expectedErr: errors.New(`invalid subnet "172.16.100.0/33": invalid CIDR address: 172.16.100.0/33`),
+		},
+		{
+			description: "subnet too large",
+
+			target: "10.0.0.0/8",
+
+			expectedErr: errors.New(`subnet "10.0.0.0/8" has more than 65536 addresses`),
+		},
+		{
+			description: "range too large",
+
+			target: "10.0-1.*.*",
+
+			expectedErr: errors.New(`range "10.0-1.*.*" has more than 65536 addresses`),
+		},
+		{
+			description: "ipv6 subnet too large",
+
+			target: "fd00::/64",
+
+			expectedErr: errors.New(`subnet "fd00::/64" has more than 65536 addresses`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scanner := &connectScanner{ctx: context.Background()}
+
+			var addresses []string
+			err := scanner.expandTarget(test.target, func(address string) bool {
+				addresses = append(addresses, address)
+				return true
+			})
+
+			assert.Equal(t, test.expectedErr, err)
+			if test.target == "localhost" && err == nil && len(addresses) == 1 && addresses[0] == "::1" {
+				// localhost can resolve to either loopback address.
+				return
+			}
+			assert.Equal(t, test.expectedAddresses, addresses)
+		})
+	}
+}
+
+func TestConnectDelay(t *testing.T) {
+	tests := []struct {
+		description string
+
+		speed int
+
+		expectedDelay time.Duration
+	}{
+		{
+			description: "paranoid",
+
+			speed: 0,
+
+			expectedDelay: 5 * time.Minute,
+		},
+		{
+			description: "sneaky",
+
+			speed: 1,
+
+			expectedDelay: 15 * time.Second,
+		},
+		{
+			description: "polite",
+
+			speed: 2,
+
+			expectedDelay: 400 * time.Millisecond,
+		},
+		{
+			description: "normal",
+
+			speed: 3,
+
+			expectedDelay: 10 * time.Millisecond,
+		},
+		{
+			description: "aggressive",
+
+			speed: 4,
+
+			expectedDelay: time.Millisecond,
+		},
+		{
+			description: "insane",
+
+			speed: 5,
+
+			expectedDelay: 0,
+		},
+		{
+			description: "speed too low",
+
+			speed: -1,
+
+			expectedDelay: 5 * time.Minute,
+		},
+		{
+			description: "speed too high",
+
+			speed: 6,
+
+			expectedDelay: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Equal(t, test.expectedDelay, connectDelay(test.speed))
+		})
+	}
+}
+
+func TestConnectScan(t *testing.T) {
+	rtsp := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		return fakeOK
+	})
+	defer rtsp.close()
+
+	http := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		return "HTTP/1.1 400 Bad Request\r\n\r\n"
+	})
+	defer http.close()
+
+	// A port that was open, but is not anymore.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to find a closed port: %v", err)
+	}
+	listener.Close()
+
+	rtspPort := rtsp.stream(t).Port
+	httpPort := http.stream(t).Port
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+
+	scanner := &Scanner{
+		term:       disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		targets:    []string{"127.0.0.1"},
+		ports:      []string{fmt.Sprintf("%d,%d", rtspPort, httpPort), strconv.Itoa(closedPort)},
+		timeout:    time.Second,
+		scanSpeed:  4,
+		httpTunnel: true,
+	}
+
+	streams, err := scanner.scan(context.Background(), scanner.newConnectScanner(context.Background()))
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Stream{
+		{Address: "127.0.0.1", Port: rtspPort},
+		{Address: "127.0.0.1", Port: httpPort, HTTPTunnel: true},
+	}, streams)
+}
+
+func TestConnectScanInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	scanner := &Scanner{
+		term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		targets: []string{"172.16.0.0/16"},
+		ports:   []string{"554"},
+	}
+
+	streams, err := scanner.scan(ctx, scanner.newConnectScanner(ctx))
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, streams)
+}
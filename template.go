@@ -0,0 +1,112 @@
+package cameradar
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultFirstChannel = 1
+	defaultLastChannel  = 16
+
+	// maxChannelRange is the largest number of channels a route template can
+	// specify in its own range, so that a single template can not flood the
+	// attack with routes.
+	maxChannelRange = 256
+)
+
+// placeholderRegexp matches the placeholders of route templates. Channel
+// placeholders can specify their own range, such as {channel:1-16}, in which
+// case channels are padded with zeros to the width of the first channel.
+var placeholderRegexp = regexp.MustCompile(`\{(user|pass|channel)(?::(\d+)-(\d+))?\}`)
+
+// expandRoutes returns the routes to attack on the given stream, in which the
+// placeholders of route templates are replaced by the credentials of the stream
+// and by each channel of their channel range.
+func (s *Scanner) expandRoutes(target Stream, routes Routes) Routes {
+	var expanded Routes
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		for _, r := range s.expandRoute(target, route) {
+			if seen[r] {
+				continue
+			}
+			seen[r] = true
+			expanded = append(expanded, r)
+		}
+	}
+
+	return expanded
+}
+
+// expandRoute returns the routes described by the given route template. All channel
+// placeholders of a template take the same value, within the range of the first one.
+func (s *Scanner) expandRoute(target Stream, route string) []string {
+	if !strings.Contains(route, "{") {
+		return []string{route}
+	}
+
+	first, last := s.firstChannel, s.lastChannel
+	hasChannel := false
+	for _, match := range placeholderRegexp.FindAllStringSubmatch(route, -1) {
+		if match[1] != "channel" {
+			continue
+		}
+
+		if !hasChannel && match[2] != "" {
+			first, _ = strconv.Atoi(match[2])
+			last, _ = strconv.Atoi(match[3])
+
+			// Templates with reversed or oversized ranges are not attacked.
+			if first > last || last-first >= maxChannelRange {
+				return nil
+			}
+		}
+		hasChannel = true
+	}
+
+	if !hasChannel {
+		return []string{s.fillRoute(target, route, 0)}
+	}
+
+	var routes []string
+	for channel := first; channel <= last; channel++ {
+		routes = append(routes, s.fillRoute(target, route, channel))
+	}
+
+	return routes
+}
+
+// fillRoute replaces the placeholders of the given route template. Until the
+// credentials of the stream are found, the ones given by the user are used.
+// Credentials are escaped for the part of the route in which they appear.
+func (s *Scanner) fillRoute(target Stream, route string, channel int) string {
+	username, password := target.Username, target.Password
+	if username == "" && password == "" {
+		username, password = s.username, s.password
+	}
+
+	fill := func(part string, escape func(string) string) string {
+		return placeholderRegexp.ReplaceAllStringFunc(part, func(placeholder string) string {
+			match := placeholderRegexp.FindStringSubmatch(placeholder)
+			switch match[1] {
+			case "user":
+				return escape(username)
+			case "pass":
+				return escape(password)
+			default:
+				return fmt.Sprintf("%0*d", len(match[2]), channel)
+			}
+		})
+	}
+
+	path, query := route, ""
+	if i := strings.Index(route, "?"); i >= 0 {
+		path, query = route[:i], route[i:]
+	}
+
+	return fill(path, url.PathEscape) + fill(query, url.QueryEscape)
+}
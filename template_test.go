@@ -0,0 +1,122 @@
+package cameradar
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandRoutes(t *testing.T) {
+	var largestChannelRange Routes
+	for channel := 1; channel <= maxChannelRange; channel++ {
+		largestChannelRange = append(largestChannelRange, fmt.Sprintf("live/ch%d", channel))
+	}
+
+	tests := []struct {
+		description string
+
+		target Stream
+		routes Routes
+
+		expectedRoutes Routes
+	}{
+		{
+			description: "routes without placeholders",
+
+			routes: Routes{"live.sdp", "h264"},
+
+			expectedRoutes: Routes{"live.sdp", "h264"},
+		},
+		{
+			description: "credentials of the stream",
+
+			target: Stream{Username: "root", Password: "p@ss/word"},
+			routes: Routes{"0/{user}:{pass}/main"},
+
+			expectedRoutes: Routes{"0/root:p@ss%2Fword/main"},
+		},
+		{
+			description: "credentials given by the user",
+
+			routes: Routes{"cam1/mpeg4?user={user}&pwd={pass}"},
+
+			expectedRoutes: Routes{"cam1/mpeg4?user=admin&pwd=12345"},
+		},
+		{
+			description: "credentials in the query",
+
+			target: Stream{Username: "root", Password: "p@ss&w=rd /"},
+			routes: Routes{"{user}/mpeg4?user={user}&pwd={pass}"},
+
+			expectedRoutes: Routes{"root/mpeg4?user=root&pwd=p%40ss%26w%3Drd+%2F"},
+		},
+		{
+			description: "default channel range",
+
+			routes: Routes{"Streaming/Channels/{channel}01"},
+
+			expectedRoutes: Routes{"Streaming/Channels/101", "Streaming/Channels/201", "Streaming/Channels/301"},
+		},
+		{
+			description: "padded channel range",
+
+			routes: Routes{"live/ch{channel:01-03}_0"},
+
+			expectedRoutes: Routes{"live/ch01_0", "live/ch02_0", "live/ch03_0"},
+		},
+		{
+			description: "several channel placeholders",
+
+			routes: Routes{"cam/realmonitor?channel={channel:1-2}&name=ch{channel:01-99}"},
+
+			expectedRoutes: Routes{"cam/realmonitor?channel=1&name=ch01", "cam/realmonitor?channel=2&name=ch02"},
+		},
+		{
+			description: "duplicated routes",
+
+			routes: Routes{"live/ch{channel:01-02}_0", "live/ch01_0"},
+
+			expectedRoutes: Routes{"live/ch01_0", "live/ch02_0"},
+		},
+		{
+			description: "empty channel range",
+
+			routes: Routes{"live/ch{channel:16-1}"},
+		},
+		{
+			description: "oversized channel range",
+
+			routes: Routes{"live/ch{channel:1-100000}", "live.sdp"},
+
+			expectedRoutes: Routes{"live.sdp"},
+		},
+		{
+			description: "largest channel range",
+
+			routes: Routes{"live/ch{channel:1-256}"},
+
+			expectedRoutes: largestChannelRange,
+		},
+		{
+			description: "unknown placeholder",
+
+			routes: Routes{"live/{stream}"},
+
+			expectedRoutes: Routes{"live/{stream}"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scanner := &Scanner{
+				username:     "admin",
+				password:     "12345",
+				firstChannel: 1,
+				lastChannel:  3,
+			}
+
+			assert.Equal(t, test.expectedRoutes, scanner.expandRoutes(test.target, test.routes))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Command mac_prefixes_generator generates the Go file which holds the MAC
+// address prefixes of dictionaries/mac-prefixes, so that they are built into
+// cameradar. It is run by go generate from the root of the repository.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+const (
+	prefixesPath = "dictionaries/mac-prefixes"
+	outputPath   = "oui_prefixes.go"
+)
+
+func main() {
+	if err := generate(); err != nil {
+		log.Fatalf(err.Error())
+	}
+}
+
+func generate() error {
+	prefixes, err := ioutil.ReadFile(prefixesPath)
+	if err != nil {
+		return fmt.Errorf("unable to read MAC address prefixes: %v", err)
+	}
+
+	if strings.Contains(string(prefixes), "`") {
+		return fmt.Errorf("MAC address prefixes can not contain backquotes")
+	}
+
+	var output bytes.Buffer
+	fmt.Fprintf(&output, "// Code generated by tools/mac_prefixes_generator from %s. DO NOT EDIT.\n\n", prefixesPath)
+	fmt.Fprintf(&output, "package cameradar\n\n")
+	fmt.Fprintf(&output, "// macPrefixes lists the MAC address prefixes assigned to camera and NVR manufacturers,\n")
+	fmt.Fprintf(&output, "// in the format of nmap's nmap-mac-prefixes file.\n")
+	fmt.Fprintf(&output, "const macPrefixes = `%s`\n", prefixes)
+
+	source, err := format.Source(output.Bytes())
+	if err != nil {
+		return fmt.Errorf("unable to format generated code: %v", err)
+	}
+
+	err = ioutil.WriteFile(outputPath, source, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %v", outputPath, err)
+	}
+
+	return nil
+}
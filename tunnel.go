@@ -0,0 +1,149 @@
+package cameradar
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTunnelPort = "80"
+
+	// tunnelContentType is the content type of both halves of an RTSP over HTTP tunnel.
+	tunnelContentType = "application/x-rtsp-tunnelled"
+)
+
+// tunnelConn is an RTSP connection tunneled in HTTP, as introduced by QuickTime.
+// The server sends RTSP responses in the body of the response to a GET request,
+// while requests are sent base64 encoded in the body of a POST request. Both HTTP
+// requests are tied together by their x-sessioncookie header.
+type tunnelConn struct {
+	get    net.Conn
+	post   net.Conn
+	reader *bufio.Reader
+}
+
+// dialTunnel opens both halves of an RTSP over HTTP tunnel to the given address.
+func dialTunnel(ctx context.Context, dialer net.Dialer, address, path string, timeout time.Duration) (net.Conn, error) {
+	get, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %q: %v", address, err)
+	}
+
+	post, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		get.Close()
+		return nil, fmt.Errorf("unable to connect to %q: %v", address, err)
+	}
+
+	conn := &tunnelConn{
+		get:    get,
+		post:   post,
+		reader: bufio.NewReader(get),
+	}
+
+	if timeout > 0 {
+		err = conn.SetDeadline(time.Now().Add(timeout))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to set deadline: %v", err)
+		}
+	}
+
+	stop := unblockOnDone(ctx, conn)
+	err = conn.open(path, randomHex(11))
+	stop()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// open sends the GET and POST requests of the tunnel, and waits for the server
+// to accept the GET request.
+func (t *tunnelConn) open(path, cookie string) error {
+	if path == "" {
+		path = "/"
+	}
+
+	_, err := fmt.Fprintf(t.get,
+		"GET %s HTTP/1.0\r\nUser-Agent: %s\r\nx-sessioncookie: %s\r\nAccept: %s\r\nPragma: no-cache\r\nCache-Control: no-cache\r\n\r\n",
+		path, rtspUserAgent, cookie, tunnelContentType,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to open HTTP tunnel: %v", err)
+	}
+
+	res, err := http.ReadResponse(t.reader, nil)
+	if err != nil {
+		return fmt.Errorf("unable to open HTTP tunnel: %v", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP tunnel refused with status %q", res.Status)
+	}
+
+	// The POST request is never completed, its body being the RTSP requests.
+	_, err = fmt.Fprintf(t.post,
+		"POST %s HTTP/1.0\r\nUser-Agent: %s\r\nx-sessioncookie: %s\r\nContent-Type: %s\r\nPragma: no-cache\r\nCache-Control: no-cache\r\nContent-Length: 32767\r\nExpires: Sun, 9 Jan 1972 00:00:00 GMT\r\n\r\n",
+		path, rtspUserAgent, cookie, tunnelContentType,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to open HTTP tunnel: %v", err)
+	}
+
+	return nil
+}
+
+// Read reads RTSP data from the GET half of the tunnel.
+func (t *tunnelConn) Read(b []byte) (int, error) {
+	return t.reader.Read(b)
+}
+
+// Write sends RTSP data base64 encoded in the POST half of the tunnel.
+func (t *tunnelConn) Write(b []byte) (int, error) {
+	_, err := t.post.Write([]byte(base64.StdEncoding.EncodeToString(b)))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (t *tunnelConn) Close() error {
+	postErr := t.post.Close()
+	err := t.get.Close()
+	if err != nil {
+		return err
+	}
+	return postErr
+}
+
+func (t *tunnelConn) LocalAddr() net.Addr {
+	return t.get.LocalAddr()
+}
+
+func (t *tunnelConn) RemoteAddr() net.Addr {
+	return t.get.RemoteAddr()
+}
+
+func (t *tunnelConn) SetDeadline(deadline time.Time) error {
+	err := t.get.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	return t.post.SetDeadline(deadline)
+}
+
+func (t *tunnelConn) SetReadDeadline(deadline time.Time) error {
+	return t.get.SetReadDeadline(deadline)
+}
+
+func (t *tunnelConn) SetWriteDeadline(deadline time.Time) error {
+	return t.post.SetWriteDeadline(deadline)
+}
@@ -0,0 +1,178 @@
+package cameradar
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/disgo"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeTunnelServer starts a fake RTSP server which is only reachable by
+// tunneling RTSP in HTTP.
+func newFakeTunnelServer(t *testing.T, handler func(req fakeRTSPRequest) string) *fakeRTSPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to start fake tunnel server: %v", err)
+	}
+
+	server := &fakeRTSPServer{
+		listener: listener,
+		handler:  handler,
+		tunnel:   true,
+		requests: make(chan fakeRTSPRequest, 100),
+	}
+
+	go server.serve()
+
+	return server
+}
+
+// serveTunnel serves one half of a tunnel. GET connections are kept until the
+// matching POST connection arrives, after which RTSP is served on both.
+func (s *fakeRTSPServer) serveTunnel(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	cookie := req.Header.Get("x-sessioncookie")
+	if cookie == "" || (req.Method == http.MethodGet && req.Header.Get("Accept") != tunnelContentType) {
+		fmt.Fprint(conn, "HTTP/1.0 404 Not Found\r\n\r\n")
+		conn.Close()
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		s.tunnels.Store(cookie, conn)
+		fmt.Fprintf(conn, "HTTP/1.0 200 OK\r\nContent-Type: %s\r\n\r\n", tunnelContentType)
+	case http.MethodPost:
+		get, ok := s.tunnels.Load(cookie)
+		if !ok {
+			conn.Close()
+			return
+		}
+
+		s.serveConn(&fakeTunnelConn{
+			Conn: get.(net.Conn),
+			body: reader,
+		})
+		conn.Close()
+	}
+}
+
+// fakeTunnelConn is the server side of a tunnel, which reads requests from
+// the POST connection and writes responses to the GET connection.
+type fakeTunnelConn struct {
+	net.Conn
+
+	body io.Reader
+}
+
+// Read decodes the base64 body of the POST request one quantum at a time, since
+// each request is encoded separately.
+func (c *fakeTunnelConn) Read(b []byte) (int, error) {
+	quantum := make([]byte, 4)
+	_, err := io.ReadFull(c.body, quantum)
+	if err != nil {
+		return 0, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(string(quantum))
+	if err != nil {
+		return 0, err
+	}
+
+	return copy(b, decoded), nil
+}
+
+func TestRTSPClientTunnel(t *testing.T) {
+	server := newFakeTunnelServer(t, func(req fakeRTSPRequest) string {
+		// Requests are sent in the tunnel using the rtsp scheme.
+		if !strings.HasPrefix(req.uri, "rtsp://") || !strings.HasSuffix(req.uri, "/live.sdp") {
+			return fakeNotFound
+		}
+		return fakeDescribeBody
+	})
+	defer server.close()
+
+	var body []byte
+	c := NewRTSPClient()
+	assert.NoError(t, c.Setopt(optTimeoutMS, 1000))
+	assert.NoError(t, c.Setopt(optHTTPTunnel, 1))
+	assert.NoError(t, c.Setopt(optURL, server.url("live.sdp")))
+	assert.NoError(t, c.Setopt(optRTSPRequest, rtspDescribe))
+	assert.NoError(t, c.Setopt(optWriteFunction, func(b []byte, _ interface{}) bool {
+		body = append(body, b...)
+		return true
+	}))
+
+	assert.NoError(t, c.Perform())
+
+	rc, err := c.Getinfo(infoResponseCode)
+	assert.NoError(t, err)
+	assert.Equal(t, httpOK, rc)
+	assert.Equal(t, "v=0\n", string(body))
+
+	req := <-server.requests
+	assert.Equal(t, "DESCRIBE", req.method)
+}
+
+func TestRTSPClientTunnelRefused(t *testing.T) {
+	server := newFakeRTSPServer(t, func(req fakeRTSPRequest) string {
+		return "HTTP/1.0 404 Not Found\r\n\r\n"
+	})
+	defer server.close()
+
+	c := NewRTSPClient()
+	assert.NoError(t, c.Setopt(optTimeoutMS, 1000))
+	assert.NoError(t, c.Setopt(optHTTPTunnel, 1))
+	assert.NoError(t, c.Setopt(optURL, server.url("live.sdp")))
+	assert.NoError(t, c.Setopt(optRTSPRequest, rtspDescribe))
+
+	err := c.Perform()
+	assert.Error(t, err)
+}
+
+func TestAttackHTTPTunnel(t *testing.T) {
+	server := newFakeTunnelServer(t, func(req fakeRTSPRequest) string {
+		if req.method != "OPTIONS" && req.header.Get("Authorization") == "" {
+			return fakeBasic
+		}
+		return fakeOK
+	})
+	defer server.close()
+
+	scanner := &Scanner{
+		term:    disgo.NewTerminal(disgo.WithDefaultOutput(ioutil.Discard)),
+		curl:    NewRTSPClient(),
+		timeout: time.Second,
+		routes:  Routes{"live.sdp"},
+		credentials: Credentials{
+			Usernames: []string{"admin"},
+			Passwords: []string{"12345"},
+		},
+	}
+
+	results, err := scanner.AttackContext(context.Background(), []Stream{server.stream(t)})
+
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.True(t, results[0].HTTPTunnel)
+		assert.Equal(t, "admin", results[0].Username)
+		assert.Equal(t, "12345", results[0].Password)
+		assert.Equal(t, authBasic, results[0].AuthenticationType)
+	}
+}